@@ -0,0 +1,122 @@
+// Command breachfilter builds the Bloom filter read by PASSWORD_BREACH_CORPUS
+// from a local copy of the Pwned Passwords SHA-1 corpus.
+//
+//	breachfilter build -corpus <range dir | HASH:COUNT file> -out breached.bloom [-fp 0.001] [-min-count 1]
+//	breachfilter check -corpus <range dir | filter file> < password.txt
+//
+// The filter never misses a breached password and wrongly flags about -fp of
+// all others. At the default rate it takes roughly 1.8 bytes per password.
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "build":
+		build(args)
+	case "check":
+		check(args)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: breachfilter build -corpus PATH -out FILE [-fp RATE] [-min-count N] | check -corpus PATH [-min-count N]")
+	os.Exit(2)
+}
+
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "range directory or HASH:COUNT file to read")
+	out := fs.String("out", "", "filter file to write")
+	fp := fs.Float64("fp", 0.001, "false positive rate")
+	minCount := fs.Int("min-count", 1, "skip passwords seen fewer times than this")
+	fs.Parse(args)
+
+	if *corpus == "" || *out == "" {
+		usage()
+	}
+	if *fp <= 0 || *fp >= 1 {
+		log.Fatal("-fp must be between 0 and 1")
+	}
+
+	// first pass sizes the filter, second fills it
+	var n uint64
+	if err := password.ReadCorpus(*corpus, *minCount, func([sha1.Size]byte) { n++ }); err != nil {
+		log.Fatal("failed to read corpus: ", err)
+	}
+	filter := password.NewBloomFilter(n, *fp)
+	if err := password.ReadCorpus(*corpus, *minCount, filter.Add); err != nil {
+		log.Fatal("failed to read corpus: ", err)
+	}
+
+	// write next to the target and rename, so a running server never reads a partial file
+	tmp := *out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	size, err := filter.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Fatal("failed to write filter: ", err)
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %s: %d passwords, %d bytes\n", *out, n, size)
+}
+
+// check reads one password per line from stdin, so they stay out of shell history.
+func check(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	path := fs.String("corpus", "", "range directory or filter file")
+	minCount := fs.Int("min-count", 1, "ignore range entries seen fewer times than this")
+	fs.Parse(args)
+
+	if *path == "" {
+		usage()
+	}
+	corpus, err := password.OpenBreachCorpus(*path, *minCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		pw := strings.TrimRight(scanner.Text(), "\r")
+		breached, err := corpus.Contains(pw)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if breached {
+			fmt.Println("breached")
+		} else {
+			fmt.Println("not found")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
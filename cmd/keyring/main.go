@@ -0,0 +1,174 @@
+// Command keyring manages the JWT signing key ring referenced by JWT_KEYRING_FILE.
+//
+//	keyring list
+//	keyring add [-alg ES256] [-promote | -sign-from 2026-01-02T15:04:05Z]
+//	keyring promote -kid <kid> [-at 2026-01-02T15:04:05Z]
+//	keyring retire [-kid <kid>] [-force]
+//
+// The running server picks up manifest changes within a few seconds.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+)
+
+func main() {
+	config.LoadEnv()
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	path := os.Getenv("JWT_KEYRING_FILE")
+	if path == "" {
+		log.Fatal("JWT_KEYRING_FILE is not set")
+	}
+	manifest, err := utils.LoadKeyRingManifest(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lifetime := utils.ConfiguredAccessTokenTTL()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "list":
+		list(manifest, lifetime)
+		return
+	case "add":
+		add(manifest, path, args)
+	case "promote":
+		promote(manifest, args)
+	case "retire":
+		retire(manifest, lifetime, args)
+	default:
+		usage()
+	}
+
+	if err := manifest.Save(path); err != nil {
+		log.Fatal("failed to save key ring: ", err)
+	}
+	list(manifest, lifetime)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keyring list | add [-alg ES256|RS256|EdDSA|HS256] [-promote|-sign-from TIME] | promote -kid KID [-at TIME] | retire [-kid KID] [-force]")
+	os.Exit(2)
+}
+
+func list(manifest *utils.KeyRingManifest, lifetime time.Duration) {
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSIGN FROM\tSTATUS")
+	for _, entry := range manifest.Keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.ID, entry.Alg, entry.SignFrom.Format(time.RFC3339), manifest.Status(entry, now, lifetime))
+	}
+	w.Flush()
+}
+
+func add(manifest *utils.KeyRingManifest, path string, args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	alg := fs.String("alg", "ES256", "signing algorithm: ES256, RS256, EdDSA or HS256")
+	promote := fs.Bool("promote", false, "make the new key the signing key immediately")
+	signFrom := fs.String("sign-from", "", "RFC 3339 time at which the key starts signing (default: one token lifetime from now, so verifiers can fetch it first)")
+	fs.Parse(args)
+
+	start := time.Now().Add(utils.ConfiguredAccessTokenTTL())
+	switch {
+	case *promote:
+		start = time.Now()
+	case *signFrom != "":
+		start = parseTime(*signFrom)
+	}
+
+	entry, err := utils.GenerateKeyFile(filepath.Dir(path), *alg)
+	if err != nil {
+		log.Fatal("failed to generate key: ", err)
+	}
+	entry.SignFrom = start.UTC().Truncate(time.Second)
+	manifest.Keys = append(manifest.Keys, entry)
+	fmt.Printf("added %s (%s), signing from %s\n", entry.ID, entry.Alg, entry.SignFrom.Format(time.RFC3339))
+}
+
+func promote(manifest *utils.KeyRingManifest, args []string) {
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	kid := fs.String("kid", "", "key to promote")
+	at := fs.String("at", "", "RFC 3339 time to start signing (default: now)")
+	fs.Parse(args)
+
+	i := manifest.Find(*kid)
+	if i < 0 {
+		log.Fatalf("unknown key %q", *kid)
+	}
+	start := time.Now()
+	if *at != "" {
+		start = parseTime(*at)
+	}
+	manifest.Keys[i].SignFrom = start.UTC().Truncate(time.Second)
+	manifest.Keys[i].RetireAt = nil
+	fmt.Printf("%s signs from %s\n", *kid, manifest.Keys[i].SignFrom.Format(time.RFC3339))
+}
+
+// retire removes superseded keys whose last tokens have expired. Naming a key
+// that still has live tokens schedules its retirement for when they expire,
+// unless -force is given.
+func retire(manifest *utils.KeyRingManifest, lifetime time.Duration, args []string) {
+	fs := flag.NewFlagSet("retire", flag.ExitOnError)
+	kid := fs.String("kid", "", "key to retire (default: every key whose tokens have expired)")
+	force := fs.Bool("force", false, "stop accepting the key immediately, even if it has live tokens")
+	fs.Parse(args)
+
+	now := time.Now()
+	if *kid != "" {
+		i := manifest.Find(*kid)
+		if i < 0 {
+			log.Fatalf("unknown key %q", *kid)
+		}
+		entry := manifest.Keys[i]
+		status := manifest.Status(entry, now, lifetime)
+		switch {
+		case status == utils.KeySigning && !*force:
+			log.Fatalf("%s is the signing key; add and promote a replacement first", *kid)
+		case status == utils.KeyRetired:
+			manifest.Keys = append(manifest.Keys[:i], manifest.Keys[i+1:]...)
+			fmt.Printf("removed %s\n", *kid)
+		case *force:
+			retireAt := now.UTC().Truncate(time.Second)
+			manifest.Keys[i].RetireAt = &retireAt
+			fmt.Printf("%s retired now; its outstanding tokens are rejected\n", *kid)
+		default:
+			supersededAt, _ := manifest.SupersededAt(entry)
+			retireAt := supersededAt.Add(lifetime + time.Minute).UTC().Truncate(time.Second)
+			manifest.Keys[i].RetireAt = &retireAt
+			fmt.Printf("%s still has live tokens; retirement scheduled for %s\n", *kid, retireAt.Format(time.RFC3339))
+		}
+		return
+	}
+
+	var kept []utils.KeyRingEntry
+	for _, entry := range manifest.Keys {
+		if manifest.Status(entry, now, lifetime) == utils.KeyRetired {
+			fmt.Printf("removed %s\n", entry.ID)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	manifest.Keys = kept
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Fatalf("invalid time %q: %v", s, err)
+	}
+	return t
+}
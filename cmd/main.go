@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/gbadegesintestimony/jwt-authentication/config"
 	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/outbox"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/purge"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
 	"github.com/gbadegesintestimony/jwt-authentication/routes"
 	"github.com/gbadegesintestimony/jwt-authentication/utils"
 	"github.com/gin-gonic/gin"
@@ -15,17 +21,42 @@ func main() {
 	// Load .env file
 	config.LoadEnv()
 
+	// Refuse to start with a password hashing setting no login could use
+	if _, err := password.Current(); err != nil {
+		log.Fatal("Invalid PASSWORD_HASH_ALGORITHM: ", err)
+	}
+
+	// Load the signing keys and the token hash key before anything uses them;
+	// the background workers below decrypt queued email with the latter
+	utils.Init()
+
 	// Initialize database
 	database.Connect()
 
+	// Create the built-in roles and promote the bootstrap administrator
+	if err := rbac.Seed(database.DB); err != nil {
+		log.Fatal("Failed to seed roles: ", err)
+	}
+	if err := rbac.BootstrapAdmin(database.DB, os.Getenv("ADMIN_EMAIL")); err != nil {
+		log.Fatal("Failed to grant admin role: ", err)
+	}
+
+	// Deliver queued email in the background; without a mailer it stays queued
+	if mailer, err := mail.FromEnv(); err != nil {
+		log.Println("Email is disabled:", err)
+	} else {
+		go outbox.NewWorker(database.DB, mailer).Run(context.Background())
+	}
+
+	// Erase accounts whose deletion grace period has run out
+	go purge.Run(context.Background(), database.DB)
+
 	// Create a new gin engine
 	r := gin.Default()
 
 	// Setup routes
 	routes.Setup(r)
 
-	utils.Init()
-
 	// Get server port from environment variable
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
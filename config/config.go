@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -17,3 +19,33 @@ func LoadEnv() {
 func Getenv(key string) string {
 	return os.Getenv(key)
 }
+
+// GetenvInt returns the integer value of key, or def when it is unset or malformed.
+func GetenvInt(key string, def int) int {
+	if s := os.Getenv(key); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// GetenvBool returns the boolean value of key, or def when it is unset or malformed.
+func GetenvBool(key string, def bool) bool {
+	if s := os.Getenv(key); s != "" {
+		if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// AppURL joins path onto APP_BASE_URL, the public address of the app that links
+// in emails point at.
+func AppURL(path string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
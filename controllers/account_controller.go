@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recentlyAuthenticated reports whether the session behind the request signed
+// in within ACCOUNT_REAUTH_MINUTES (default 5). Refreshing a session does not
+// make it recent.
+func recentlyAuthenticated(c *gin.Context, userID uint) bool {
+	claims, _ := c.MustGet("claims").(*utils.Claims)
+	if claims == nil || claims.SessionID == "" {
+		return false
+	}
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", claims.SessionID, userID).First(&session).Error; err != nil {
+		return false
+	}
+	window := time.Duration(config.GetenvInt("ACCOUNT_REAUTH_MINUTES", 5)) * time.Minute
+	return time.Since(session.CreatedAt) < window
+}
+
+// confirmIdentity guards a sensitive change: it needs the current password, or
+// a session that signed in recently, so a stolen access token alone is not
+// enough. It writes the error response, naming action, when neither is given.
+func confirmIdentity(c *gin.Context, user models.User, plain, action string) bool {
+	if plain != "" {
+		if ok, err := password.Verify(plain, user.PasswordHash); err != nil || !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+			return false
+		}
+		return true
+	}
+	if !recentlyAuthenticated(c, user.ID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "confirm your password, or sign in again, to " + action, "code": codeReauthRequired})
+		return false
+	}
+	return true
+}
+
+// invalidateOutstandingCodes retires every emailed token, reset OTP, login
+// code and pending email change of userID, so none is redeemable afterwards.
+func invalidateOutstandingCodes(tx *gorm.DB, userID uint) error {
+	now := time.Now()
+	if err := tx.Model(&models.ActionToken{}).
+		Where("user_id = ? AND consumed_at IS NULL", userID).
+		Update("consumed_at", now).Error; err != nil {
+		return err
+	}
+	if err := invalidateResetRequests(tx, userID, 0); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.LoginCode{}).
+		Where("user_id = ? AND consumed_at IS NULL AND invalidated_at IS NULL", userID).
+		Update("invalidated_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.EmailChange{}).
+		Where("user_id = ? AND confirmed_at IS NULL AND invalidated_at IS NULL", userID).
+		Update("invalidated_at", now).Error
+}
+
+// DeleteAccount soft-deletes the caller's account and signs every device out.
+// The account is erased for good after ACCOUNT_DELETION_GRACE_DAYS (default
+// 30); until then the emailed link restores it.
+func DeleteAccount(c *gin.Context) {
+	var input models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, "delete your account") {
+		return
+	}
+
+	// sign out first, so a failure cannot leave a deleted account with live tokens
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	grace := time.Duration(config.GetenvInt("ACCOUNT_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour
+	purgeAfter := time.Now().Add(grace)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("purge_after", purgeAfter).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := invalidateOutstandingCodes(tx, user.ID); err != nil {
+			return err
+		}
+
+		token, err := createActionToken(tx, user.ID, models.PurposeAccountRestore, grace)
+		if err != nil {
+			return err
+		}
+		link := config.AppURL("/restore-account?token=" + url.QueryEscape(token))
+		return queueSecretEmail(tx, c, user, mail.TemplateAccountDeleted, mail.Data{
+			"Link":      link,
+			"PurgeDate": purgeAfter.UTC().Format(time.RFC1123),
+		}, grace)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deleted", "purge_after": purgeAfter.UTC().Format(time.RFC3339)})
+}
+
+// RestoreAccount undoes DeleteAccount using the token from its email, as long
+// as the account has not been purged yet. The user signs in again afterwards.
+func RestoreAccount(c *gin.Context) {
+	var input models.RestoreAccountRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	record, err := consumeActionToken(models.PurposeAccountRestore, input.Token)
+	if err != nil {
+		if errors.Is(err, errInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired restore token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore account"})
+		}
+		return
+	}
+
+	res := database.DB.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND purge_after > ?", record.UserID, time.Now()).
+		Updates(map[string]interface{}{"deleted_at": nil, "purge_after": nil})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore account"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired restore token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account restored"})
+}
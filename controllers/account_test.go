@@ -0,0 +1,120 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/purge"
+)
+
+func TestDeleteAndRestoreAccount(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("ACCOUNT_REAUTH_MINUTES", "0")
+	g := setupTestServer(t)
+	auth := registerAndLogin(t, g, "dan@example.com", "password123")
+
+	login := func() int {
+		return doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "dan@example.com", Password: "password123"}, "").Code
+	}
+	restore := func(token string) int {
+		return doJSON(g, http.MethodPost, "/api/auth/account/restore", models.RestoreAccountRequest{Token: token}, "").Code
+	}
+
+	w := doJSON(g, http.MethodDelete, "/api/me", nil, auth.Token)
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeReauthRequired {
+		t.Fatalf("expected reauthentication to be required, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodDelete, "/api/me", models.DeleteAccountRequest{Password: "wrong-password"}, auth.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be refused, got %d", w.Code)
+	}
+
+	// codes emailed before the deletion
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "dan@example.com"}, "")
+	resetOTP := otpPattern.FindString(lastEmailTo(t, "dan@example.com").Text)
+	doJSON(g, http.MethodPost, "/api/auth/otp/request", models.LoginCodeRequest{Email: "dan@example.com"}, "")
+	loginCode := otpPattern.FindString(lastEmailTo(t, "dan@example.com").Text)
+
+	if w := doJSON(g, http.MethodDelete, "/api/me", models.DeleteAccountRequest{Password: "password123"}, auth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the deleted account to be signed out, got %d", w.Code)
+	}
+	if code := login(); code != http.StatusUnauthorized {
+		t.Fatalf("expected a deleted account not to sign in, got %d", code)
+	}
+
+	// the emailed link brings it back, once
+	token := linkToken(t, lastEmailTo(t, "dan@example.com"))
+	if code := restore(token); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := restore(token); code != http.StatusBadRequest {
+		t.Fatalf("expected the link to work once, got %d", code)
+	}
+	if code := login(); code != http.StatusOK {
+		t.Fatalf("expected the restored account to sign in, got %d", code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/verify-otp", models.VerifyOTPRequest{Email: "dan@example.com", OTP: resetOTP}, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a reset OTP from before the deletion to be void, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "dan@example.com", OTP: loginCode}, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a login code from before the deletion to be void, got %d", w.Code)
+	}
+
+	// right after signing in, no password is needed
+	t.Setenv("ACCOUNT_REAUTH_MINUTES", "5")
+	fresh := loginFrom(t, g, "dan@example.com", "password123", "test")
+	if w := doJSON(g, http.MethodDelete, "/api/me", nil, fresh.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	token = linkToken(t, lastEmailTo(t, "dan@example.com"))
+
+	// nothing is purged during the grace period
+	var user models.User
+	database.DB.Unscoped().Where("email = ?", "dan@example.com").First(&user)
+	expires := time.Now().Add(time.Hour)
+	for _, key := range []string{"auth-email:email:dan@example.com", fmt.Sprintf("user:user:%d", user.ID), "auth-email:email:dan@example.org"} {
+		database.DB.Create(&models.RateLimitBucket{Key: key, ExpiresAt: expires})
+	}
+	database.DB.Create(&models.EmailChange{UserID: user.ID, OldEmail: "dan.old@example.com", NewEmail: "dan@example.com"})
+	for _, addr := range []string{"Dan@example.com", "dan.old@example.com"} {
+		database.DB.Create(&models.OutboxMessage{ToAddress: addr, Subject: "queued before messages had a user", Status: models.OutboxDead, NextAttemptAt: time.Now()})
+	}
+	if n, err := purge.Due(context.Background(), database.DB, time.Now()); err != nil || n != 0 {
+		t.Fatalf("expected nothing to purge yet, got %d, %v", n, err)
+	}
+	if n, err := purge.Due(context.Background(), database.DB, time.Now().AddDate(0, 0, 31)); err != nil || n != 1 {
+		t.Fatalf("expected the account to be purged, got %d, %v", n, err)
+	}
+
+	var left int64
+	database.DB.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Count(&left)
+	for _, table := range []interface{}{&models.Session{}, &models.RefreshToken{}, &models.PasswordHistory{}, &models.ActionToken{}} {
+		var n int64
+		database.DB.Model(table).Where("user_id = ?", user.ID).Count(&n)
+		left += n
+	}
+	var roles, mail, buckets int64
+	database.DB.Table("user_roles").Where("user_id = ?", user.ID).Count(&roles)
+	database.DB.Model(&models.OutboxMessage{}).Where("user_id = ? OR LOWER(to_address) IN ?", user.ID, []string{"dan@example.com", "dan.old@example.com"}).Count(&mail)
+	database.DB.Model(&models.RateLimitBucket{}).Where("bucket_key <> ?", "auth-email:email:dan@example.org").Count(&buckets)
+	if left+roles+mail+buckets != 0 {
+		t.Fatalf("expected the account and its rows to be gone, %d left", left+roles+mail+buckets)
+	}
+	if database.DB.Model(&models.RateLimitBucket{}).Count(&buckets); buckets != 1 {
+		t.Fatalf("expected other addresses' counters to be kept, %d left", buckets)
+	}
+	if code := restore(token); code != http.StatusBadRequest {
+		t.Fatalf("expected a purged account not to be restored, got %d", code)
+	}
+
+	// the address is free again
+	registerAndLogin(t, g, "dan@example.com", "password123")
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"gorm.io/gorm"
+)
+
+var errInvalidActionToken = errors.New("invalid or expired token")
+
+// createActionToken issues a single-use emailed token for purpose using tx.
+// Outstanding tokens for the same user and purpose are invalidated so only the
+// newest link works.
+func createActionToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	return createBoundActionToken(tx, userID, purpose, ttl, "")
+}
+
+// createBoundActionToken is createActionToken for a token that can only be
+// redeemed together with binding, unless binding is empty.
+func createBoundActionToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration, binding string) (string, error) {
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+		Update("consumed_at", now).Error; err != nil {
+		return "", err
+	}
+
+	record := models.ActionToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashSecret(purpose, secret),
+		ExpiresAt: now.Add(ttl),
+	}
+	if binding != "" {
+		record.BindingHash = utils.HashSecret(purpose+"_binding", binding)
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// consumeActionToken redeems secret for purpose. It succeeds at most once per token.
+func consumeActionToken(purpose, secret string) (models.ActionToken, error) {
+	return consumeBoundActionToken(purpose, secret, "")
+}
+
+// consumeBoundActionToken is consumeActionToken that also accepts tokens made
+// by createBoundActionToken, provided binding matches. A wrong binding does
+// not use up the token.
+func consumeBoundActionToken(purpose, secret, binding string) (models.ActionToken, error) {
+	record, err := findBoundActionToken(purpose, secret, binding)
+	if err != nil {
+		return models.ActionToken{}, err
+	}
+	if err := claimActionToken(record); err != nil {
+		return models.ActionToken{}, err
+	}
+	return record, nil
+}
+
+// findBoundActionToken looks up a redeemable token like consumeBoundActionToken,
+// but leaves it unused, for callers with checks to make before claiming it.
+func findBoundActionToken(purpose, secret, binding string) (models.ActionToken, error) {
+	var record models.ActionToken
+	err := database.DB.Where("token_hash = ? AND purpose = ?", utils.HashSecret(purpose, secret), purpose).First(&record).Error
+	if err != nil {
+		return models.ActionToken{}, errInvalidActionToken
+	}
+	if record.ConsumedAt != nil || time.Now().After(record.ExpiresAt) {
+		return models.ActionToken{}, errInvalidActionToken
+	}
+	if record.BindingHash != "" && !utils.SecretMatches(purpose+"_binding", binding, record.BindingHash) {
+		return models.ActionToken{}, errInvalidActionToken
+	}
+	return record, nil
+}
+
+// claimActionToken uses up a token found by findBoundActionToken. Only one
+// caller can claim it.
+func claimActionToken(record models.ActionToken) error {
+	res := database.DB.Model(&models.ActionToken{}).
+		Where("id = ? AND consumed_at IS NULL", record.ID).
+		Update("consumed_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errInvalidActionToken
+	}
+	return nil
+}
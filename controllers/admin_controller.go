@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUsersPerPage = 20
+	maxUsersPerPage     = 100
+)
+
+func adminUserResponse(user models.User) models.AdminUserResponse {
+	resp := models.AdminUserResponse{
+		ID:                    user.ID,
+		Email:                 user.Email,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		EmailVerified:         user.IsEmailVerified(),
+		MFAEnabled:            len(mfaMethods(user)) > 0,
+		Roles:                 make([]string, 0, len(user.Roles)),
+		Disabled:              user.IsDisabled(),
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt.Format(time.RFC3339),
+	}
+	for _, role := range user.Roles {
+		resp.Roles = append(resp.Roles, role.Name)
+	}
+	if user.DisabledAt != nil {
+		resp.DisabledAt = user.DisabledAt.Format(time.RFC3339)
+	}
+	if user.DeletedAt.Valid {
+		resp.DeletedAt = user.DeletedAt.Time.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func respondWithAdminUser(c *gin.Context, status int, message string, user models.User) {
+	response := models.SuccessResponse{}
+	response.Success.Status = status
+	response.Success.Message = message
+	response.Success.Data = adminUserResponse(user)
+	c.JSON(status, response)
+}
+
+// reloadAdminUser writes the current state of user after an admin action.
+func reloadAdminUser(c *gin.Context, message string, userID uint) {
+	var user models.User
+	if err := database.DB.Unscoped().Preload("Roles").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load user"})
+		return
+	}
+	respondWithAdminUser(c, http.StatusOK, message, user)
+}
+
+// isSelf reports whether the admin is acting on their own account, writing a
+// conflict response if so. Admins cannot lock themselves out.
+func isSelf(c *gin.Context, user models.User) bool {
+	if uid, _ := c.Get("userID"); uid == user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot perform this action on your own account"})
+		return true
+	}
+	return false
+}
+
+// ListUsers returns a page of users. Query parameters: page, per_page, q
+// (matches email or name), status (active, disabled, deleted or all),
+// verified (true/false) and role.
+func ListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultUsersPerPage)))
+	if perPage < 1 || perPage > maxUsersPerPage {
+		perPage = defaultUsersPerPage
+	}
+
+	query := database.DB.Model(&models.User{})
+	switch c.Query("status") {
+	case "":
+	case "active":
+		query = query.Where("disabled_at IS NULL")
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "deleted":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	case "all":
+		query = query.Unscoped()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, disabled, deleted or all"})
+		return
+	}
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? OR LOWER(name) LIKE ?", like, like, like, like)
+	}
+	if v := c.Query("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "verified must be true or false"})
+			return
+		}
+		if verified {
+			query = query.Where("email_verified_at IS NOT NULL")
+		} else {
+			query = query.Where("email_verified_at IS NULL")
+		}
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("id IN (?)", database.DB.Table("user_roles").
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ?", role))
+	}
+
+	// the query is shared by the count and the page fetch
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list users"})
+		return
+	}
+	var users []models.User
+	if err := query.Preload("Roles").Order("id").Offset((page - 1) * perPage).Limit(perPage).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list users"})
+		return
+	}
+
+	list := models.AdminUserList{Users: make([]models.AdminUserResponse, 0, len(users)), Page: page, PerPage: perPage, Total: total}
+	for _, user := range users {
+		list.Users = append(list.Users, adminUserResponse(user))
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = http.StatusOK
+	response.Success.Message = "Users"
+	response.Success.Data = list
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUser returns a single user, including soft-deleted ones.
+func GetUser(c *gin.Context) {
+	user, ok := userFromParam(c, true)
+	if !ok {
+		return
+	}
+	respondWithAdminUser(c, http.StatusOK, "User", user)
+}
+
+// CreateUser creates an account on behalf of a user. It gets the default role
+// unless roles are given.
+func CreateUser(c *gin.Context) {
+	var input models.AdminCreateUserRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	roleNames := input.Roles
+	if len(roleNames) == 0 {
+		roleNames = []string{rbac.DefaultRole}
+	}
+	var roles []models.Role
+	if err := database.DB.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load roles"})
+		return
+	}
+	for _, name := range roleNames {
+		found := false
+		for _, role := range roles {
+			found = found || role.Name == name
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + name})
+			return
+		}
+	}
+
+	// the unique index covers soft-deleted accounts too
+	var existing int64
+	database.DB.Unscoped().Model(&models.User{}).Where("email = ?", input.Email).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+		return
+	}
+
+	if !checkPasswordPolicy(c, input.Password, models.User{Email: input.Email, FirstName: input.FirstName, LastName: input.LastName}) {
+		return
+	}
+
+	hashed, err := password.Hash(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	now := time.Now()
+	user := models.User{
+		FirstName:             input.FirstName,
+		LastName:              input.LastName,
+		Name:                  strings.TrimSpace(input.FirstName + " " + input.LastName),
+		Email:                 input.Email,
+		PasswordHash:          hashed,
+		PasswordChangedAt:     &now,
+		PasswordResetRequired: input.RequirePasswordReset,
+		Roles:                 roles,
+	}
+	if input.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email already in use or invalid"})
+		return
+	}
+	if err := recordPassword(database.DB, user.ID, hashed); err != nil {
+		log.Println("failed to record password history:", err)
+	}
+
+	if !user.IsEmailVerified() {
+		if err := sendVerificationEmail(nil, user); err != nil {
+			log.Println("failed to send verification email:", err)
+		}
+	}
+
+	respondWithAdminUser(c, http.StatusCreated, "User created", user)
+}
+
+// DisableUser blocks the account from signing in and ends all its sessions.
+func DisableUser(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok || isSelf(c, user) {
+		return
+	}
+
+	if !user.IsDisabled() {
+		if err := database.DB.Model(&user).Update("disabled_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not disable user"})
+			return
+		}
+	}
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+	reloadAdminUser(c, "User disabled", user.ID)
+}
+
+// EnableUser lifts a previous DisableUser.
+func EnableUser(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+	if err := database.DB.Model(&user).Update("disabled_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not enable user"})
+		return
+	}
+	reloadAdminUser(c, "User enabled", user.ID)
+}
+
+// ForcePasswordReset signs the user out everywhere, blocks login until they
+// choose a new password, and emails them a reset code.
+func ForcePasswordReset(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("password_reset_required", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update user"})
+		return
+	}
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+	if err := startPasswordReset(c, user, models.ResetInitiatorAdmin); err != nil {
+		log.Println("failed to send password reset email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send OTP email"})
+		return
+	}
+	reloadAdminUser(c, "Password reset required", user.ID)
+}
+
+// ForceLogout revokes every access and refresh token the user holds.
+func ForceLogout(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+	reloadAdminUser(c, "User logged out", user.ID)
+}
+
+// DeleteUser soft-deletes the user and ends all its sessions. The account can
+// be brought back with RestoreUser.
+func DeleteUser(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok || isSelf(c, user) {
+		return
+	}
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+	if err := database.DB.Delete(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete user"})
+		return
+	}
+	reloadAdminUser(c, "User deleted", user.ID)
+}
+
+// RestoreUser undoes a soft delete.
+func RestoreUser(c *gin.Context) {
+	user, ok := userFromParam(c, true)
+	if !ok {
+		return
+	}
+	if !user.DeletedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "user is not deleted"})
+		return
+	}
+	// this also cancels the purge of an account its owner deleted
+	if err := database.DB.Unscoped().Model(&user).Updates(map[string]interface{}{"deleted_at": nil, "purge_after": nil}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not restore user"})
+		return
+	}
+	reloadAdminUser(c, "User restored", user.ID)
+}
+
+// SetEmailVerified marks the user's email address as verified or unverified.
+func SetEmailVerified(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+	var input models.AdminEmailVerifiedRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	var verifiedAt interface{}
+	if *input.Verified {
+		if user.EmailVerifiedAt != nil {
+			verifiedAt = *user.EmailVerifiedAt
+		} else {
+			verifiedAt = time.Now()
+		}
+	}
+	if err := database.DB.Model(&user).Update("email_verified_at", verifiedAt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update user"})
+		return
+	}
+	reloadAdminUser(c, "Email verification updated", user.ID)
+}
@@ -0,0 +1,170 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+// loginAdmin registers email, grants it the admin role and logs it in.
+func loginAdmin(t *testing.T, g *gin.Engine, email string) models.AuthData {
+	t.Helper()
+	registerAndLogin(t, g, email, "password123")
+	if err := rbac.BootstrapAdmin(database.DB, email); err != nil {
+		t.Fatalf("bootstrap admin: %v", err)
+	}
+	w := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: email, Password: "password123"}, "")
+	return decodeAuthData(t, w)
+}
+
+func decodeAdminUsers(t *testing.T, w *httptest.ResponseRecorder) models.AdminUserList {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 listing users, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Success struct {
+			Data models.AdminUserList `json:"data"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid user list: %v", err)
+	}
+	return resp.Success.Data
+}
+
+func decodeAdminUser(t *testing.T, w *httptest.ResponseRecorder) models.AdminUserResponse {
+	t.Helper()
+	var resp struct {
+		Success struct {
+			Data models.AdminUserResponse `json:"data"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid user response: %v", err)
+	}
+	return resp.Success.Data
+}
+
+var otpPattern = regexp.MustCompile(`\b(\d{6})\b`)
+
+func TestAdminUserManagement(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	admin := loginAdmin(t, g, "root@example.com")
+
+	created := models.AdminCreateUserRequest{FirstName: "Ann", LastName: "Lee", Email: "ann@example.com", Password: "password123", EmailVerified: true}
+	w := doJSON(g, http.MethodPost, "/api/admin/users", created, admin.Token)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating user, got %d: %s", w.Code, w.Body.String())
+	}
+	if ann := decodeAdminUser(t, w); !ann.EmailVerified || len(ann.Roles) != 1 || ann.Roles[0] != rbac.RoleUser {
+		t.Fatalf("unexpected created user: %+v", ann)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/admin/users", created, admin.Token); w.Code != http.StatusConflict {
+		t.Fatalf("expected duplicate email to be rejected, got %d", w.Code)
+	}
+
+	bob := registerAndLogin(t, g, "bob@example.com", "password123")
+	if w := doJSON(g, http.MethodGet, "/api/admin/users", nil, bob.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", w.Code)
+	}
+
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users?q=ANN", nil, admin.Token)); list.Total != 1 || list.Users[0].Email != "ann@example.com" {
+		t.Fatalf("unexpected search result: %+v", list)
+	}
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users?verified=false", nil, admin.Token)); list.Total != 2 {
+		t.Fatalf("expected two unverified users, got %+v", list)
+	}
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users?role=admin", nil, admin.Token)); list.Total != 1 || list.Users[0].ID != admin.User.ID {
+		t.Fatalf("unexpected role filter result: %+v", list)
+	}
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users?per_page=1&page=2", nil, admin.Token)); list.Total != 3 || len(list.Users) != 1 || list.Users[0].Email != "ann@example.com" {
+		t.Fatalf("unexpected page: %+v", list)
+	}
+
+	userPath := fmt.Sprintf("/api/admin/users/%d", bob.User.ID)
+	login := models.LoginRequest{Email: "bob@example.com", Password: "password123"}
+
+	// disable / enable
+	if w := doJSON(g, http.MethodPost, userPath+"/disable", nil, admin.Token); w.Code != http.StatusOK || !decodeAdminUser(t, w).Disabled {
+		t.Fatalf("expected user to be disabled, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, bob.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected disabled user's token to be revoked, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: bob.RefreshToken}, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected disabled user's refresh token to be revoked, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected disabled user to be refused, got %d", w.Code)
+	}
+	doJSON(g, http.MethodPost, userPath+"/enable", nil, admin.Token)
+	w = doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected enabled user to log in, got %d", w.Code)
+	}
+	bob = decodeAuthData(t, w)
+
+	// forced logout
+	doJSON(g, http.MethodPost, userPath+"/logout", nil, admin.Token)
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, bob.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected forced logout to revoke token, got %d", w.Code)
+	}
+
+	// forced password reset
+	if w := doJSON(g, http.MethodPost, userPath+"/force-password-reset", nil, admin.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected forced reset, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected login to require a reset, got %d", w.Code)
+	}
+	resetPasswordWithOTP(t, g, "bob@example.com", "newpass456")
+	login.Password = "newpass456"
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected login after reset, got %d", w.Code)
+	}
+
+	// soft delete / restore
+	if w := doJSON(g, http.MethodDelete, userPath, nil, admin.Token); w.Code != http.StatusOK || decodeAdminUser(t, w).DeletedAt == "" {
+		t.Fatalf("expected user to be deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected deleted user to be unable to log in, got %d", w.Code)
+	}
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users", nil, admin.Token)); list.Total != 2 {
+		t.Fatalf("expected deleted user to be hidden, got %+v", list)
+	}
+	if list := decodeAdminUsers(t, doJSON(g, http.MethodGet, "/api/admin/users?status=deleted", nil, admin.Token)); list.Total != 1 || list.Users[0].ID != bob.User.ID {
+		t.Fatalf("expected deleted user in deleted filter, got %+v", list)
+	}
+	if w := doJSON(g, http.MethodPost, userPath+"/restore", nil, admin.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected restore, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected restored user to log in, got %d", w.Code)
+	}
+
+	// manual verification toggle
+	w = doJSON(g, http.MethodPut, userPath+"/email-verified", gin.H{"verified": true}, admin.Token)
+	if w.Code != http.StatusOK || !decodeAdminUser(t, w).EmailVerified {
+		t.Fatalf("expected email to be marked verified, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, userPath, nil, admin.Token); !decodeAdminUser(t, w).EmailVerified {
+		t.Fatalf("expected verified flag to persist")
+	}
+
+	selfPath := fmt.Sprintf("/api/admin/users/%d", admin.User.ID)
+	if w := doJSON(g, http.MethodPost, selfPath+"/disable", nil, admin.Token); w.Code != http.StatusConflict {
+		t.Fatalf("expected admin to be unable to disable themselves, got %d", w.Code)
+	}
+}
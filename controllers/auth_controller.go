@@ -6,11 +6,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gbadegesintestimony/jwt-authentication/config"
 	"github.com/gbadegesintestimony/jwt-authentication/database"
 	"github.com/gbadegesintestimony/jwt-authentication/models"
-	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func Register(c *gin.Context) {
@@ -45,8 +47,12 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if !checkPasswordPolicy(c, input.Password, models.User{Email: input.Email, FirstName: first, LastName: last}) {
+		return
+	}
+
 	// Hash password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	hashed, err := password.Hash(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
@@ -54,37 +60,33 @@ func Register(c *gin.Context) {
 
 	// create user with first and last name; keep Name for backward compatibility
 	// Build user record (keep `Name` for compatibility)
+	now := time.Now()
 	user := models.User{
-		FirstName:    first,
-		LastName:     last,
-		Name:         strings.TrimSpace(first + " " + last),
-		Email:        input.Email,
-		PasswordHash: string(hashed),
+		FirstName:         first,
+		LastName:          last,
+		Name:              strings.TrimSpace(first + " " + last),
+		Email:             input.Email,
+		PasswordHash:      hashed,
+		PasswordChangedAt: &now,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "email already in use or invalid"})
 		return
 	}
-	token, _ := utils.GenerateToken(32)
-
-	userResponse := models.DetailedUserResponse{
-		ID:            user.ID,
-		Email:         user.Email,
-		FirstName:     user.FirstName,
-		LastName:      user.LastName,
-		CreatedAt:     user.CreatedAt.Format(time.RFC3339),
-		EmailVerified: false,
+	if err := recordPassword(database.DB, user.ID, hashed); err != nil {
+		log.Println("failed to record password history:", err)
+	}
+	if err := rbac.Assign(user.ID, rbac.DefaultRole); err != nil {
+		log.Println("failed to assign default role:", err)
 	}
-	response := models.SuccessResponse{}
-	response.Success.Status = http.StatusCreated
-	response.Success.Message = "User Registered successful"
-	response.Success.Data = models.AuthData{
-		User:  userResponse,
-		Token: token,
+	if err := sendVerificationEmail(c, user); err != nil {
+		log.Println("failed to send verification email:", err)
 	}
 
-	c.JSON(http.StatusCreated, response)
+	// Log the new user straight in unless they must verify their email first.
+	autoLogin := config.GetenvBool("REGISTER_AUTO_LOGIN", true) && !config.GetenvBool("REQUIRE_EMAIL_VERIFICATION", false)
+	respondWithAuth(c, http.StatusCreated, "User Registered successful", user, autoLogin)
 }
 
 func Login(c *gin.Context) {
@@ -96,198 +98,187 @@ func Login(c *gin.Context) {
 
 	var user models.User
 	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials", "code": codeInvalidCredentials})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if loginBlocked(c, user) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+	if ok, err := password.Verify(input.Password, user.PasswordHash); err != nil || !ok {
+		recordLoginFailure(c, user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials", "code": codeInvalidCredentials})
 		return
 	}
 
-	userResponse := models.DetailedUserResponse{
-		ID:            user.ID,
-		Email:         user.Email,
-		FirstName:     user.FirstName,
-		LastName:      user.LastName,
-		CreatedAt:     user.CreatedAt.Format(time.RFC3339),
-		EmailVerified: false,
+	// with a second factor to come, the failures are cleared once it is in, so
+	// signing in again does not reset the guesses against it
+	if (user.FailedLoginAttempts > 0 || user.LockedUntil != nil) && len(mfaMethods(user)) == 0 {
+		clearLoginFailures(user.ID)
 	}
-	response := models.SuccessResponse{}
-	response.Success.Status = http.StatusOK
-	response.Success.Message = "Login successful"
-	response.Success.Data = models.AuthData{
-		User:  userResponse,
-		Token: token,
+	if password.NeedsRehash(user.PasswordHash) {
+		rehashPassword(user, input.Password)
 	}
-
-	c.JSON(http.StatusOK, response)
-
-}
-
-// ChangePassword allows an authenticated user to change their password
-func ChangePassword(c *gin.Context) {
-	var input models.ChangePasswordRequest
-	if err := c.BindJSON(&input); err != nil {
-		// c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})s
+	// with a second factor enrolled the new password waits for /mfa/verify
+	if passwordExpired(user) && len(mfaMethods(user)) == 0 && !replaceExpiredPassword(c, &user, input.NewPassword) {
 		return
 	}
 
-	// get user id from context (set by middleware)
-	uid, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
+	completeLogin(c, user)
+}
 
-	userID, ok := uid.(uint)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id in token"})
+// rehashPassword replaces the stored hash of user with one made under the
+// current hashing policy. It runs after a successful login, the only time the
+// plaintext is available.
+func rehashPassword(user models.User, plain string) {
+	hashed, err := password.Hash(plain)
+	if err != nil {
+		log.Println("failed to rehash password:", err)
 		return
 	}
-
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-		return
+	// only replace the hash that was verified, in case the password just changed
+	err = database.DB.Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+		Update("password_hash", hashed).Error
+	if err != nil {
+		log.Println("failed to store rehashed password:", err)
 	}
+}
 
-	// verify current password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.CurrentPassword)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
-		return
+// loginAllowed applies the account checks every login method shares, writing
+// the error response when the user may not sign in.
+func loginAllowed(c *gin.Context, user models.User) bool {
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled", "code": codeAccountDisabled})
+		return false
 	}
-
-	// hash new password
-	newHashed, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash new password"})
-		return
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "password reset required", "code": codePasswordResetRequired})
+		return false
 	}
-
-	if err := database.DB.Model(&user).Update("password_hash", string(newHashed)).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
-		return
+	if config.GetenvBool("REQUIRE_EMAIL_VERIFICATION", false) && !user.IsEmailVerified() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified", "code": codeEmailNotVerified})
+		return false
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+	return true
 }
 
-func ForgotPassword(c *gin.Context) {
-	type Body struct {
-		Email string `json:"email" binding:"required,email"`
+// passwordlessLoginAllowed applies to a login without a password the checks
+// Login makes around its password: lockout and backoff, loginAllowed, and an
+// expired password, which there is no new password to replace with unless an
+// MFA challenge follows (VerifyMFA takes one). It writes the error response
+// when the user may not sign in.
+func passwordlessLoginAllowed(c *gin.Context, user models.User, mfaFollows bool) bool {
+	if loginBlocked(c, user) || !loginAllowed(c, user) {
+		return false
 	}
+	if passwordExpired(user) && !mfaFollows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "password has expired; log in with your password and a new_password", "code": codePasswordExpired})
+		return false
+	}
+	return true
+}
 
-	var req Body
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
-
-		return
+// withEmailProven returns user as it will be once the emailed link or code
+// being redeemed has verified the address.
+func withEmailProven(user models.User) models.User {
+	if !user.IsEmailVerified() {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
 	}
+	return user
+}
 
+// sendIfAccountExists runs send for the account registered to email, if there
+// is one, and then answers 200 with response either way. Failures are only
+// logged, so the reply never reveals whether the account exists.
+func sendIfAccountExists(c *gin.Context, email string, response gin.H, send func(user models.User) error) {
 	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		// To prevent email enumeration, respond with success even if user not found
-		c.JSON(http.StatusOK, gin.H{"message": "If email exists, OTP has been sent"})
-		return
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err == nil {
+		if err := send(user); err != nil {
+			log.Println("failed to email account:", err)
+		}
 	}
-	log.Printf("User found: %v", user.Email)
+	c.JSON(http.StatusOK, response)
+}
 
-	otp, err := utils.GenerateOTP()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate OTP"})
+// completeLogin finishes a login once the first factor has been checked. It
+// returns either AuthData or, when the user has a second factor enrolled, an
+// MFA challenge.
+func completeLogin(c *gin.Context, user models.User) {
+	if !loginAllowed(c, user) {
 		return
 	}
 
-	user.ResetOTP = otp
-	user.ResetExpiry = time.Now().Add(15 * time.Minute)
-	database.DB.Save(&user)
-
-	if err := utils.SendEmail(
-		user.Email,
-		"Password Reset OTP",
-		"Your OTP for password reset is: "+otp+"\nIt expires in 15 minutes.",
-	); err != nil {
-
-		log.Println("SMTP ERROR:", err)
-
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to send OTP email",
-		})
+	if methods := mfaMethods(user); len(methods) > 0 {
+		respondWithMFAChallenge(c, user, methods)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "OTP has been sent to your email",
-	})
+	respondWithAuth(c, http.StatusOK, "Login successful", user, true)
 }
 
-func VerifyOTP(c *gin.Context) {
-	type Request struct {
-		Email string `json:"email" binding:"required,email"`
-		OTP   string `json:"otp" binding:"required"`
-	}
-	var req Request
-	if err := c.BindJSON(&req); err != nil {
+// ChangePassword allows an authenticated user to change their password
+func ChangePassword(c *gin.Context) {
+	var input models.ChangePasswordRequest
+	if err := c.BindJSON(&input); err != nil {
+		// c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})s
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email or OTP"})
+	// get user id from context (set by middleware)
+	uid, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	if user.ResetOTP != req.OTP || time.Now().After(user.ResetExpiry) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP"})
+	userID, ok := uid.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id in token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "OTP verified successfully"})
-}
-
-func ResetPassword(c *gin.Context) {
-	type Input struct {
-		Email           string `json:"email" binding:"required,email"`
-		OTP             string `json:"otp" binding:"required"`
-		NewPassword     string `json:"new_password" binding:"required,min=6"`
-		ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=NewPassword"`
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
 	}
 
-	var req Input
-	if err := c.BindJSON(&req); err != nil {
+	// verify current password
+	if ok, err := password.Verify(input.CurrentPassword, user.PasswordHash); err != nil || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
 		return
 	}
 
-	if req.NewPassword != req.ConfirmPassword {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "new password and confirm password do not match"})
+	if !checkPasswordPolicy(c, input.NewPassword, user) {
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email or OTP"})
+	// hash new password
+	newHashed, err := password.Hash(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash new password"})
 		return
 	}
 
-	if user.ResetOTP != req.OTP || time.Now().After(user.ResetExpiry) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP"})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := storePassword(tx, user.ID, newHashed, nil); err != nil {
+			return err
+		}
+		queuePasswordChangedAlert(tx, c, user)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
 		return
 	}
 
-	newHashed, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	user.PasswordHash = string(newHashed)
-	user.ResetOTP = ""
-	database.DB.Save(&user)
+	// every token issued before the change, including the caller's, stops working
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		log.Println("failed to revoke tokens after password change:", err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
 }
@@ -1,50 +1,174 @@
-package controllers
+package controllers_test
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
 	"github.com/gbadegesintestimony/jwt-authentication/database"
-	"github.com/gbadegesintestimony/jwt-authentication/middleware"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
 	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/outbox"
+	"github.com/gbadegesintestimony/jwt-authentication/ratelimit"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gbadegesintestimony/jwt-authentication/routes"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 )
 
+// rateClock drives the rate limiters of the server under test.
+var rateClock *ratelimit.FakeClock
+
+// sentMail records the emails sent by the server under test, once
+// deliverMail has run mailWorker over the outbox.
+var (
+	sentMail   *mail.MemoryMailer
+	mailWorker *outbox.Worker
+)
+
+// deliverMail attempts every queued email that is due.
+func deliverMail(t *testing.T) {
+	t.Helper()
+	if _, err := mailWorker.Drain(context.Background()); err != nil {
+		t.Fatalf("failed to deliver mail: %v", err)
+	}
+}
+
+// lastEmailTo delivers queued email and returns the most recent one sent to addr.
+func lastEmailTo(t *testing.T, addr string) mail.Message {
+	t.Helper()
+	deliverMail(t)
+	msg, ok := sentMail.Last(addr)
+	if !ok {
+		t.Fatalf("no email sent to %s", addr)
+	}
+	return msg
+}
+
+var linkTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_%-]+)`)
+
+// linkToken extracts the token query parameter from the link in an email body.
+func linkToken(t *testing.T, email mail.Message) string {
+	t.Helper()
+	m := linkTokenPattern.FindStringSubmatch(email.Text)
+	if m == nil {
+		t.Fatalf("no link token in email: %s", email.Text)
+	}
+	token, _ := url.QueryUnescape(m[1])
+	return token
+}
+
+// setupTestServer serves the routes of routes.Register, rate limited on
+// rateClock, from a fresh in-memory database.
 func setupTestServer(t *testing.T) *gin.Engine {
+	// keep password hashing cheap; the costs are not what is under test
+	t.Setenv("ARGON2_MEMORY_KIB", "1024")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("SCRYPT_LOG_N", "10")
+	// fixture passwords are simple; TestPasswordPolicy covers the strength rule
+	t.Setenv("PASSWORD_MIN_SCORE", "0")
+
+	t.Setenv("TOKEN_HASH_SECRET", "test-token-hash-secret")
+
 	// use in-memory sqlite for tests
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("failed to open sqlite: %v", err)
 	}
+	// every connection to :memory: is a separate database, so keep just one
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
 	database.DB = db
-	database.DB.AutoMigrate(&models.User{})
+	if err := database.Migrate(database.DB); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := rbac.Seed(database.DB); err != nil {
+		t.Fatalf("failed to seed roles: %v", err)
+	}
+	utils.Init()
+	rateClock = ratelimit.NewFakeClock(time.Now())
+	sentMail = mail.NewMemoryMailer("Test <noreply@example.com>")
+	mailWorker = &outbox.Worker{DB: database.DB, Mailer: sentMail, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Lease: time.Minute}
+
+	// the per-IP limit is raised since every test request comes from the same
+	// address and the clock stands still
+	if _, ok := os.LookupEnv("RATE_LIMIT_AUTH_PER_MINUTE"); !ok {
+		t.Setenv("RATE_LIMIT_AUTH_PER_MINUTE", "1000")
+	}
 
 	g := gin.Default()
-	// register handlers directly to avoid import cycle with routes
-	api := g.Group("/api")
-	{
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", Register)
-			auth.POST("/login", Login)
-		}
+	routes.Register(g, rateClock)
+	return g
+}
 
-		protected := api.Group("/")
-		protected.Use(middleware.AuthMiddleware())
-		{
-			protected.POST("/change-password", ChangePassword)
-			protected.GET("/me", GetProfile)
-			protected.PUT("/me", UpdateProfile)
-		}
+// doJSON sends body as JSON to path, with an optional bearer token.
+func doJSON(g *gin.Engine, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
 	}
-	return g
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	return w
+}
+
+// decodeAuthData extracts the AuthData payload from a success response.
+func decodeAuthData(t *testing.T, w *httptest.ResponseRecorder) models.AuthData {
+	t.Helper()
+	var resp struct {
+		Success struct {
+			Data models.AuthData `json:"data"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode auth response: %v: %s", err, w.Body.String())
+	}
+	return resp.Success.Data
+}
+
+func registerAndLogin(t *testing.T, g *gin.Engine, email, password string) models.AuthData {
+	t.Helper()
+	w := doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Test", LastName: "User", Email: email, Password: password}, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 created, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: email, Password: password}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 ok on login, got %d: %s", w.Code, w.Body.String())
+	}
+	return decodeAuthData(t, w)
 }
 
 func TestRegisterLoginChangeProfile(t *testing.T) {
@@ -72,9 +196,7 @@ func TestRegisterLoginChangeProfile(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 ok on login, got %d: %s", w.Code, w.Body.String())
 	}
-	var loginResp map[string]string
-	json.Unmarshal(w.Body.Bytes(), &loginResp)
-	token := loginResp["token"]
+	token := decodeAuthData(t, w).Token
 	if token == "" {
 		t.Fatalf("expected token in login response")
 	}
@@ -91,7 +213,21 @@ func TestRegisterLoginChangeProfile(t *testing.T) {
 		t.Fatalf("expected 200 ok on change-password, got %d: %s", w.Code, w.Body.String())
 	}
 
-	// Get profile
+	// Changing the password revokes the token issued before the change
+	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with pre-change token, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Get profile with a token for the new password
+	w = doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "alice@example.com", Password: "newpass456"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 ok on login with new password, got %d: %s", w.Code, w.Body.String())
+	}
+	token = decodeAuthData(t, w).Token
 	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	w = httptest.NewRecorder()
@@ -100,3 +236,360 @@ func TestRegisterLoginChangeProfile(t *testing.T) {
 		t.Fatalf("expected 200 ok on get profile, got %d: %s", w.Code, w.Body.String())
 	}
 }
+
+func TestRefreshRotationAndReuseDetection(t *testing.T) {
+	g := setupTestServer(t)
+	first := registerAndLogin(t, g, "bob@example.com", "password123")
+	if first.RefreshToken == "" || first.TokenExpiresAt == "" || first.RefreshTokenExpiresAt == "" {
+		t.Fatalf("expected refresh token and expiry metadata, got %+v", first)
+	}
+
+	w := doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: first.RefreshToken}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on refresh, got %d: %s", w.Code, w.Body.String())
+	}
+	second := decodeAuthData(t, w)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a rotated refresh token")
+	}
+
+	// Replaying the rotated token must fail and revoke the whole family.
+	w = doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: first.RefreshToken}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 on reuse, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: second.RefreshToken}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for descendant after reuse, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	g := setupTestServer(t)
+	first := registerAndLogin(t, g, "carol@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/auth/logout", models.LogoutRequest{RefreshToken: first.RefreshToken}, first.Token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on logout, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, first.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after logout, got %d", w.Code)
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: first.RefreshToken}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 refreshing after logout, got %d", w.Code)
+	}
+
+	// logout-all revokes tokens from every other login as well
+	second := decodeAuthData(t, doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "carol@example.com", Password: "password123"}, ""))
+	third := decodeAuthData(t, doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "carol@example.com", Password: "password123"}, ""))
+	if w = doJSON(g, http.MethodPost, "/api/auth/logout-all", nil, third.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on logout-all, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, second.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for other session after logout-all, got %d", w.Code)
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: second.RefreshToken}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 refreshing after logout-all, got %d", w.Code)
+	}
+}
+
+func TestAsymmetricSigningAndJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		alg    string
+		kty    string
+		signer crypto.Signer
+	}{
+		{"RS256", "RSA", rsaKey},
+		{"ES256", "EC", ecKey},
+		{"EdDSA", "OKP", edKey},
+	}
+	for _, tc := range cases {
+		t.Run(tc.alg, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(tc.signer)
+			if err != nil {
+				t.Fatalf("marshal key: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "signing.pem")
+			os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+			t.Setenv("JWT_PRIVATE_KEY_FILE", path)
+
+			g := setupTestServer(t)
+			data := registerAndLogin(t, g, "dave@example.com", "password123")
+
+			w := doJSON(g, http.MethodGet, "/.well-known/jwks.json", nil, "")
+			var set utils.JWKSet
+			if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil || len(set.Keys) != 1 {
+				t.Fatalf("expected one published key, got %s", w.Body.String())
+			}
+			jwk := set.Keys[0]
+			if jwk.Alg != tc.alg || jwk.Kty != tc.kty || jwk.Kid == "" {
+				t.Fatalf("unexpected jwk %+v", jwk)
+			}
+
+			// a downstream verifier only needs the public key selected by kid
+			parsed, err := jwt.Parse(data.Token, func(token *jwt.Token) (interface{}, error) {
+				if token.Header["kid"] != jwk.Kid {
+					t.Fatalf("token kid %v does not match jwks kid %s", token.Header["kid"], jwk.Kid)
+				}
+				return tc.signer.Public(), nil
+			}, jwt.WithValidMethods([]string{tc.alg}))
+			if err != nil || !parsed.Valid {
+				t.Fatalf("token did not verify with published key: %v", err)
+			}
+
+			if w = doJSON(g, http.MethodGet, "/api/me", nil, data.Token); w.Code != http.StatusOK {
+				t.Fatalf("expected 200 with %s token, got %d", tc.alg, w.Code)
+			}
+		})
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.json")
+	t.Setenv("JWT_KEYRING_FILE", path)
+
+	oldKey, err := utils.GenerateKeyFile(dir, "ES256")
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	oldKey.SignFrom = time.Now().Add(-2 * time.Hour)
+	manifest := &utils.KeyRingManifest{Keys: []utils.KeyRingEntry{oldKey}}
+	if err := manifest.Save(path); err != nil {
+		t.Fatalf("save manifest: %v", err)
+	}
+
+	g := setupTestServer(t)
+	before := registerAndLogin(t, g, "erin@example.com", "password123")
+
+	// Promote a new key: it signs new tokens while the old key keeps verifying.
+	newKey, _ := utils.GenerateKeyFile(dir, "EdDSA")
+	newKey.SignFrom = time.Now().Add(-time.Second)
+	manifest.Keys = append(manifest.Keys, newKey)
+	manifest.Save(path)
+	utils.Init()
+
+	w := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "erin@example.com", Password: "password123"}, "")
+	after := decodeAuthData(t, w)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(after.Token, &utils.Claims{})
+	if parsed.Header["kid"] != newKey.ID {
+		t.Fatalf("expected new tokens signed by %s, got %v", newKey.ID, parsed.Header["kid"])
+	}
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, before.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected token from previous key to verify during overlap, got %d", w.Code)
+	}
+	var set utils.JWKSet
+	json.Unmarshal(doJSON(g, http.MethodGet, "/.well-known/jwks.json", nil, "").Body.Bytes(), &set)
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected both keys published during overlap, got %d", len(set.Keys))
+	}
+
+	// Once every token from the old key has expired it is no longer accepted.
+	manifest.Keys[1].SignFrom = time.Now().Add(-time.Hour)
+	manifest.Save(path)
+	utils.Init()
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, before.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected retired key to be rejected, got %d", w.Code)
+	}
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, after.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected token from signing key to verify, got %d", w.Code)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+	g := setupTestServer(t)
+
+	w := doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Frank", LastName: "Hill", Email: "frank@example.com", Password: "password123"}, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 created, got %d: %s", w.Code, w.Body.String())
+	}
+	if data := decodeAuthData(t, w); data.Token != "" || data.RefreshToken != "" {
+		t.Fatalf("expected no tokens while verification is required, got %+v", data)
+	}
+	login := models.LoginRequest{Email: "frank@example.com", Password: "password123"}
+	if w = doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for unverified account, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Resending invalidates the first link.
+	first := linkToken(t, lastEmailTo(t, "frank@example.com"))
+	database.DB.Model(&models.ActionToken{}).Where("1 = 1").Update("created_at", time.Now().Add(-time.Hour))
+	doJSON(g, http.MethodPost, "/api/auth/resend-verification", models.ResendVerificationRequest{Email: "frank@example.com"}, "")
+	token := linkToken(t, lastEmailTo(t, "frank@example.com"))
+	if token == first {
+		t.Fatalf("expected a new verification token")
+	}
+	if w = doJSON(g, http.MethodPost, "/api/auth/verify-email", models.VerifyEmailRequest{Token: first}, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected superseded token to be rejected, got %d", w.Code)
+	}
+
+	if w = doJSON(g, http.MethodPost, "/api/auth/verify-email", models.VerifyEmailRequest{Token: token}, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 verifying email, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = doJSON(g, http.MethodPost, "/api/auth/verify-email", models.VerifyEmailRequest{Token: token}, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected verification token to be single use, got %d", w.Code)
+	}
+
+	w = doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after verification, got %d: %s", w.Code, w.Body.String())
+	}
+	if !decodeAuthData(t, w).User.EmailVerified {
+		t.Fatalf("expected email_verified to be true")
+	}
+}
+
+func TestRegisterIssuesTokenForNewUser(t *testing.T) {
+	g := setupTestServer(t)
+	// a second account makes sure the token is not bound to a fixed user id
+	registerAndLogin(t, g, "grace@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{Name: "Heidi Klum", Email: "heidi@example.com", Password: "password123"}, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 created, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeAuthData(t, w)
+	if data.Token == "" || data.RefreshToken == "" || data.TokenExpiresAt == "" {
+		t.Fatalf("expected register to return the same auth data as login, got %+v", data)
+	}
+
+	w = doJSON(g, http.MethodGet, "/api/me", nil, data.Token)
+	var profile struct {
+		ID    uint   `json:"id"`
+		Email string `json:"email"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	if w.Code != http.StatusOK || profile.ID != data.User.ID || profile.Email != "heidi@example.com" {
+		t.Fatalf("expected token for the new user, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Setenv("REGISTER_AUTO_LOGIN", "false")
+	w = doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{Name: "Ivan", Email: "ivan@example.com", Password: "password123"}, "")
+	if data = decodeAuthData(t, w); w.Code != http.StatusCreated || data.Token != "" || data.User.Email != "ivan@example.com" {
+		t.Fatalf("expected user without tokens when auto login is off, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func decodeMFAChallenge(t *testing.T, w *httptest.ResponseRecorder) models.MFAChallenge {
+	t.Helper()
+	var resp struct {
+		Success struct {
+			Data models.MFAChallenge `json:"data"`
+		} `json:"success"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.Success.Data.MFARequired || resp.Success.Data.MFAToken == "" {
+		t.Fatalf("expected an mfa challenge, got %d: %s", w.Code, w.Body.String())
+	}
+	return resp.Success.Data
+}
+
+func TestTOTPTwoFactorLogin(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE_SECONDS", "0")
+	g := setupTestServer(t)
+	data := registerAndLogin(t, g, "judy@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/me/mfa/totp/enroll", nil, data.Token)
+	var enroll models.TOTPEnrollResponse
+	json.Unmarshal(w.Body.Bytes(), &enroll)
+	if w.Code != http.StatusOK || enroll.Secret == "" || !strings.HasPrefix(enroll.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("unexpected enroll response %d: %s", w.Code, w.Body.String())
+	}
+
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(enroll.Secret, step)
+	w = doJSON(g, http.MethodPost, "/api/me/mfa/totp/confirm", models.TOTPConfirmRequest{Code: code}, data.Token)
+	var recovery models.RecoveryCodesResponse
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	if w.Code != http.StatusOK || len(recovery.RecoveryCodes) != 10 {
+		t.Fatalf("expected ten recovery codes, got %d: %s", w.Code, w.Body.String())
+	}
+
+	login := models.LoginRequest{Email: "judy@example.com", Password: "password123"}
+	challenge := decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+	if w = doJSON(g, http.MethodGet, "/api/me", nil, challenge.MFAToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected challenge token to be refused as an access token, got %d", w.Code)
+	}
+
+	// the code used for enrollment cannot be replayed
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: code}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected replayed code to be rejected, got %d", w.Code)
+	}
+	next, _ := utils.TOTPCode(enroll.Secret, step+1)
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: next}, "")
+	if w.Code != http.StatusOK || decodeAuthData(t, w).Token == "" {
+		t.Fatalf("expected tokens after mfa, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, RecoveryCode: recovery.RecoveryCodes[1]}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected challenge token to be single use, got %d", w.Code)
+	}
+
+	// recovery codes work once each
+	challenge = decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, RecoveryCode: strings.ToUpper(recovery.RecoveryCodes[0])}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected recovery code to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	challenge = decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, RecoveryCode: recovery.RecoveryCodes[0]}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected used recovery code to be rejected, got %d", w.Code)
+	}
+}
+
+func TestMFAAttemptLimit(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE_SECONDS", "0")
+	t.Setenv("MFA_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "5")
+	g := setupTestServer(t)
+	data := registerAndLogin(t, g, "mallory@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/me/mfa/totp/enroll", nil, data.Token)
+	var enroll models.TOTPEnrollResponse
+	json.Unmarshal(w.Body.Bytes(), &enroll)
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(enroll.Secret, step)
+	doJSON(g, http.MethodPost, "/api/me/mfa/totp/confirm", models.TOTPConfirmRequest{Code: code}, data.Token)
+	next, _ := utils.TOTPCode(enroll.Secret, step+1)
+	wrong := "000000"
+	if next == wrong {
+		wrong = "111111"
+	}
+
+	login := models.LoginRequest{Email: "mallory@example.com", Password: "password123"}
+	challenge := decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+	verify := func(code string) *httptest.ResponseRecorder {
+		return doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: code}, "")
+	}
+	for i := 1; i < 3; i++ {
+		if w := verify(wrong); w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), controllers.CodeMFAAttemptsExceeded) {
+			t.Fatalf("miss %d: expected a plain rejection, got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	if w := verify(wrong); w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeMFAAttemptsExceeded {
+		t.Fatalf("expected the challenge to be used up, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := verify(next); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked challenge to refuse a right code, got %d", w.Code)
+	}
+
+	// signing in again does not reset the count, and the misses lead to a lockout
+	for range 2 {
+		challenge = decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+		if w := verify(wrong); errorCode(t, w) != controllers.CodeMFAAttemptsExceeded {
+			t.Fatalf("expected the new challenge to be used up at once, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusLocked || errorCode(t, w) != controllers.CodeAccountLocked {
+		t.Fatalf("expected the account to be locked, got %d: %s", w.Code, w.Body.String())
+	}
+}
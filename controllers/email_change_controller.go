@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HashSecret purposes of the two email change tokens.
+const (
+	purposeEmailChangeConfirm = "email_change_confirm"
+	purposeEmailChangeRevert  = "email_change_revert"
+)
+
+var errEmailTaken = errors.New("email already in use")
+
+// emailTaken reports whether an account other than userID, deleted or not,
+// holds email. Soft-deleted rows still count against the unique index.
+func emailTaken(tx *gorm.DB, email string, userID uint) (bool, error) {
+	var n int64
+	err := tx.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&n).Error
+	return n > 0, err
+}
+
+// RequestEmailChange emails a confirmation link to new_email and a notice to
+// the current address. The address changes only when the link is used. The
+// reply is the same when new_email belongs to another account, so it cannot
+// be used to find out which addresses are registered; that address is then
+// sent nothing.
+func RequestEmailChange(c *gin.Context) {
+	var input models.ChangeEmailRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if ok, err := password.Verify(input.CurrentPassword, user.PasswordHash); err != nil || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+
+	newEmail := strings.TrimSpace(input.NewEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new email is the same as the current one"})
+		return
+	}
+	taken, err := emailTaken(database.DB, newEmail, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+	ttl := config.GetenvInt("EMAIL_CHANGE_TTL_MINUTES", 60)
+	now := time.Now()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// only the newest request can be confirmed
+		if err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND invalidated_at IS NULL", user.ID).
+			Update("invalidated_at", now).Error; err != nil {
+			return err
+		}
+		// the owner of a taken address is not contacted, nor is the change recorded
+		if !taken {
+			if err := tx.Create(&models.EmailChange{
+				UserID:           user.ID,
+				OldEmail:         user.Email,
+				NewEmail:         newEmail,
+				ConfirmTokenHash: utils.HashSecret(purposeEmailChangeConfirm, token),
+				ConfirmExpiresAt: now.Add(time.Duration(ttl) * time.Minute),
+			}).Error; err != nil {
+				return err
+			}
+
+			recipient := user
+			recipient.Email = newEmail
+			link := config.AppURL("/confirm-email-change?token=" + url.QueryEscape(token))
+			if err := queueSecretEmail(tx, c, recipient, mail.TemplateEmailChange, mail.Data{
+				"Link":           link,
+				"NewEmail":       newEmail,
+				"ExpiresMinutes": ttl,
+			}, time.Duration(ttl)*time.Minute); err != nil {
+				return err
+			}
+		}
+		return queueEmail(tx, c, user, mail.TemplateSecurityAlert, mail.Data{
+			"Event":    securityEventEmailChangeRequested,
+			"NewEmail": newEmail,
+			"Time":     now.UTC().Format(time.RFC1123),
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "a confirmation link has been sent to the new address"})
+}
+
+// ConfirmEmailChange moves the account to its new address using the token
+// from the confirmation email, and sends the old address a link to undo it.
+func ConfirmEmailChange(c *gin.Context) {
+	var input models.EmailChangeTokenRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	invalidToken := func() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidActionToken.Error()})
+	}
+
+	var change models.EmailChange
+	if err := database.DB.Where("confirm_token_hash = ?", utils.HashSecret(purposeEmailChangeConfirm, input.Token)).First(&change).Error; err != nil {
+		invalidToken()
+		return
+	}
+	if change.ConfirmedAt != nil || change.InvalidatedAt != nil || time.Now().After(change.ConfirmExpiresAt) {
+		invalidToken()
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, change.UserID).Error; err != nil || user.Email != change.OldEmail {
+		invalidToken()
+		return
+	}
+
+	revertToken, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+	revertTTL := config.GetenvInt("EMAIL_CHANGE_REVERT_HOURS", 72)
+	now := time.Now()
+	revertHash := utils.HashSecret(purposeEmailChangeRevert, revertToken)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// claim the token so it can only be used once
+		res := tx.Model(&models.EmailChange{}).
+			Where("id = ? AND confirmed_at IS NULL AND invalidated_at IS NULL", change.ID).
+			Updates(map[string]interface{}{
+				"confirmed_at":      now,
+				"revert_token_hash": revertHash,
+				"revert_expires_at": now.Add(time.Duration(revertTTL) * time.Hour),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidActionToken
+		}
+
+		// someone may have taken the address since it was requested
+		if taken, err := emailTaken(tx, change.NewEmail, user.ID); err != nil {
+			return err
+		} else if taken {
+			return errEmailTaken
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":             change.NewEmail,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		link := config.AppURL("/revert-email-change?token=" + url.QueryEscape(revertToken))
+		return queueSecretEmail(tx, c, user, mail.TemplateSecurityAlert, mail.Data{
+			"Event":        securityEventEmailChanged,
+			"NewEmail":     change.NewEmail,
+			"Time":         now.UTC().Format(time.RFC1123),
+			"Link":         link,
+			"ExpiresHours": revertTTL,
+		}, time.Duration(revertTTL)*time.Hour)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidActionToken):
+			invalidToken()
+		case errors.Is(err, errEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": errEmailTaken.Error()})
+		default:
+			// the unique index catches an address taken between the check and the update
+			if taken, _ := emailTaken(database.DB, change.NewEmail, user.ID); taken {
+				c.JSON(http.StatusConflict, gin.H{"error": errEmailTaken.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email address changed", "email": change.NewEmail})
+}
+
+// RevertEmailChange restores the address an email change replaced, using the
+// link sent to that address. Whoever made the change is assumed to know the
+// password, so every session is signed out and a password reset is required.
+func RevertEmailChange(c *gin.Context) {
+	var input models.EmailChangeTokenRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	invalidToken := func() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidActionToken.Error()})
+	}
+
+	var change models.EmailChange
+	if err := database.DB.Where("revert_token_hash = ?", utils.HashSecret(purposeEmailChangeRevert, input.Token)).First(&change).Error; err != nil {
+		invalidToken()
+		return
+	}
+	if change.RevertedAt != nil || change.RevertExpiresAt == nil || time.Now().After(*change.RevertExpiresAt) {
+		invalidToken()
+		return
+	}
+
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.EmailChange{}).
+			Where("id = ? AND reverted_at IS NULL", change.ID).
+			Update("reverted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidActionToken
+		}
+
+		if taken, err := emailTaken(tx, change.OldEmail, change.UserID); err != nil {
+			return err
+		} else if taken {
+			return errEmailTaken
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).Updates(map[string]interface{}{
+			"email":                   change.OldEmail,
+			"email_verified_at":       now,
+			"password_reset_required": true,
+		}).Error; err != nil {
+			return err
+		}
+		// and whatever else was asked for from the account
+		return tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND invalidated_at IS NULL", change.UserID).
+			Update("invalidated_at", now).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidActionToken):
+			invalidToken()
+		case errors.Is(err, errEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": errEmailTaken.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore email"})
+		}
+		return
+	}
+
+	if err := revokeAllUserTokens(change.UserID); err != nil {
+		log.Println("failed to revoke tokens after email revert:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email address restored; reset your password to sign in again", "email": change.OldEmail})
+}
@@ -0,0 +1,98 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+func TestChangeEmail(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	auth := registerAndLogin(t, g, "ann@example.com", "password123")
+	registerAndLogin(t, g, "bob@example.com", "password123")
+
+	change := func(newEmail, password string) int {
+		return doJSON(g, http.MethodPost, "/api/me/email", models.ChangeEmailRequest{NewEmail: newEmail, CurrentPassword: password}, auth.Token).Code
+	}
+	confirm := func(token string) int {
+		return doJSON(g, http.MethodPost, "/api/auth/email/confirm", models.EmailChangeTokenRequest{Token: token}, "").Code
+	}
+	login := func(email string) int {
+		return doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: email, Password: "password123"}, "").Code
+	}
+
+	if code := change("ann.new@example.com", "wrong-password"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the password to be required, got %d", code)
+	}
+
+	// a taken address gets the same answer, and its owner is sent nothing
+	deliverMail(t)
+	before := len(sentMail.Messages())
+	if code := change("bob@example.com", "password123"); code != http.StatusOK {
+		t.Fatalf("expected a taken address not to be revealed, got %d", code)
+	}
+	if msg := lastEmailTo(t, "ann@example.com"); msg.Subject != "A change of your email address was requested" || len(sentMail.Messages()) != before+1 {
+		t.Fatalf("expected only the usual notice to the old address, got %d emails", len(sentMail.Messages())-before)
+	}
+	var pending int64
+	database.DB.Model(&models.EmailChange{}).Where("new_email = ?", "bob@example.com").Count(&pending)
+	if pending != 0 {
+		t.Fatalf("expected no change to be recorded for a taken address")
+	}
+
+	// an address taken between request and confirmation is caught at confirmation
+	if code := change("late@example.com", "password123"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	lateToken := linkToken(t, lastEmailTo(t, "late@example.com"))
+	registerAndLogin(t, g, "late@example.com", "password123")
+	if code := confirm(lateToken); code != http.StatusConflict {
+		t.Fatalf("expected 409 for an address taken since, got %d", code)
+	}
+
+	if code := change("ann.new@example.com", "password123"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if msg := lastEmailTo(t, "ann@example.com"); msg.Subject != "A change of your email address was requested" {
+		t.Fatalf("expected a notice to the old address, got %q", msg.Subject)
+	}
+	token := linkToken(t, lastEmailTo(t, "ann.new@example.com"))
+	if code := confirm(lateToken); code != http.StatusBadRequest {
+		t.Fatalf("expected an older request to be superseded, got %d", code)
+	}
+
+	// nothing changes until the new address confirms
+	if code := login("ann@example.com"); code != http.StatusOK {
+		t.Fatalf("expected the old address to work before confirmation, got %d", code)
+	}
+	if code := confirm(token); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := confirm(token); code != http.StatusBadRequest {
+		t.Fatalf("expected the link to work once, got %d", code)
+	}
+	if login("ann@example.com") != http.StatusUnauthorized || login("ann.new@example.com") != http.StatusOK {
+		t.Fatalf("expected only the new address to sign in")
+	}
+
+	// the old address can undo it, which also locks out whoever made the change
+	alert := lastEmailTo(t, "ann@example.com")
+	if alert.Subject != "Your email address was changed" {
+		t.Fatalf("expected a change alert to the old address, got %q", alert.Subject)
+	}
+	w := doJSON(g, http.MethodPost, "/api/auth/email/revert", models.EmailChangeTokenRequest{Token: linkToken(t, alert)}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "ann@example.com", Password: "password123"}, "")
+	if w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordResetRequired {
+		t.Fatalf("expected a password reset to be required, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected existing sessions to be signed out, got %d", w.Code)
+	}
+}
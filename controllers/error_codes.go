@@ -0,0 +1,20 @@
+package controllers
+
+// Machine-readable codes returned in the "code" field of error responses, so
+// clients can tell apart states that share an HTTP status.
+const (
+	codeInvalidCredentials    = "invalid_credentials"
+	codeLoginThrottled        = "login_throttled"
+	codeAccountLocked         = "account_locked"
+	codeAccountDisabled       = "account_disabled"
+	codePasswordResetRequired = "password_reset_required"
+	codeEmailNotVerified      = "email_not_verified"
+	codeOTPInvalid            = "otp_invalid"
+	codeOTPExpired            = "otp_expired"
+	codeOTPAttemptsExceeded   = "otp_attempts_exceeded"
+	codeMFAAttemptsExceeded   = "mfa_attempts_exceeded"
+	codeResetTokenInvalid     = "reset_token_invalid"
+	codePasswordPolicy        = "password_policy"
+	codePasswordExpired       = "password_expired"
+	codeReauthRequired        = "reauthentication_required"
+)
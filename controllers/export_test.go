@@ -0,0 +1,19 @@
+package controllers
+
+// Error codes, for the tests in package controllers_test.
+const (
+	CodeInvalidCredentials    = codeInvalidCredentials
+	CodeLoginThrottled        = codeLoginThrottled
+	CodeAccountLocked         = codeAccountLocked
+	CodeAccountDisabled       = codeAccountDisabled
+	CodePasswordResetRequired = codePasswordResetRequired
+	CodeEmailNotVerified      = codeEmailNotVerified
+	CodeOTPInvalid            = codeOTPInvalid
+	CodeOTPExpired            = codeOTPExpired
+	CodeOTPAttemptsExceeded   = codeOTPAttemptsExceeded
+	CodeMFAAttemptsExceeded   = codeMFAAttemptsExceeded
+	CodeResetTokenInvalid     = codeResetTokenInvalid
+	CodePasswordPolicy        = codePasswordPolicy
+	CodePasswordExpired       = codePasswordExpired
+	CodeReauthRequired        = codeReauthRequired
+)
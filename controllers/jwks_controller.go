@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys that verify our access tokens.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
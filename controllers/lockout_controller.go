@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// unlockTokenTTL is how long the link in an account-locked email stays valid.
+const unlockTokenTTL = 24 * time.Hour
+
+// loginBackoff is how long a user with failures consecutive wrong passwords
+// must wait before the next attempt: LOGIN_BACKOFF_BASE_SECONDS doubled for
+// every failure after the first, capped at LOGIN_BACKOFF_MAX_SECONDS.
+func loginBackoff(failures int) time.Duration {
+	base := config.GetenvInt("LOGIN_BACKOFF_BASE_SECONDS", 1)
+	if failures <= 0 || base <= 0 {
+		return 0
+	}
+	max := float64(config.GetenvInt("LOGIN_BACKOFF_MAX_SECONDS", 30))
+	seconds := math.Min(float64(base)*math.Pow(2, float64(failures-1)), max)
+	return time.Duration(seconds) * time.Second
+}
+
+// loginBlocked rejects a password attempt while the account is locked or still
+// inside its backoff window. It runs before the password is checked, so a
+// blocked attempt never reveals whether the password was right.
+func loginBlocked(c *gin.Context, user models.User) bool {
+	now := time.Now()
+	if user.IsLocked(now) {
+		c.JSON(http.StatusLocked, gin.H{
+			"error":        "account is temporarily locked after too many failed attempts",
+			"code":         codeAccountLocked,
+			"locked_until": user.LockedUntil.Format(time.RFC3339),
+		})
+		return true
+	}
+
+	if user.LastFailedLoginAt != nil {
+		retryAt := user.LastFailedLoginAt.Add(loginBackoff(user.FailedLoginAttempts))
+		if now.Before(retryAt) {
+			wait := int(math.Ceil(retryAt.Sub(now).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(wait))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "too many failed attempts, try again later",
+				"code":        codeLoginThrottled,
+				"retry_after": wait,
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// recordLoginFailure counts a wrong password or second factor for user and
+// returns the consecutive failures so far. Reaching LOGIN_MAX_ATTEMPTS locks
+// the account for LOGIN_LOCKOUT_MINUTES and emails the owner a link to unlock
+// it early.
+func recordLoginFailure(c *gin.Context, user models.User) int {
+	now := time.Now()
+	err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+		"last_failed_login_at":  now,
+	}).Error
+	if err != nil {
+		log.Println("failed to record login failure:", err)
+		return 0
+	}
+
+	var failures int
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Pluck("failed_login_attempts", &failures)
+	maxAttempts := config.GetenvInt("LOGIN_MAX_ATTEMPTS", 5)
+	if maxAttempts <= 0 || failures < maxAttempts {
+		return failures
+	}
+
+	lockedUntil := now.Add(time.Duration(config.GetenvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"last_failed_login_at":  nil,
+			"locked_until":          lockedUntil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		// the lockout stands even if the email cannot be queued
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			return queueUnlockEmail(tx, c, user, lockedUntil)
+		}); err != nil {
+			log.Println("failed to queue unlock email:", err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("failed to lock account:", err)
+		return failures
+	}
+	log.Printf("account %d locked after %d failed logins", user.ID, failures)
+	return failures
+}
+
+// clearLoginFailures resets the failure counters and any lockout on userID.
+func clearLoginFailures(userID uint) {
+	err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"last_failed_login_at":  nil,
+		"locked_until":          nil,
+	}).Error
+	if err != nil {
+		log.Println("failed to clear login failures:", err)
+	}
+}
+
+func queueUnlockEmail(tx *gorm.DB, c *gin.Context, user models.User, lockedUntil time.Time) error {
+	token, err := createActionToken(tx, user.ID, models.PurposeAccountUnlock, unlockTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.AppURL("/unlock-account?token=" + url.QueryEscape(token))
+	return queueSecretEmail(tx, c, user, mail.TemplateSecurityAlert, mail.Data{
+		"Event": securityEventAccountLocked,
+		"Until": lockedUntil.UTC().Format(time.RFC1123),
+		"Link":  link,
+	}, unlockTokenTTL)
+}
+
+// UnlockAccount lifts a lockout using the token from the account-locked email.
+func UnlockAccount(c *gin.Context) {
+	var input models.UnlockAccountRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	record, err := consumeActionToken(models.PurposeAccountUnlock, input.Token)
+	if err != nil {
+		if errors.Is(err, errInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired unlock token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock account"})
+		}
+		return
+	}
+
+	clearLoginFailures(record.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+}
@@ -0,0 +1,129 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gin-gonic/gin"
+)
+
+// errorCode returns the "code" field of an error response.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	return resp.Code
+}
+
+func TestLoginLockoutAndUnlock(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE_SECONDS", "0")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "eve@example.com", "password123")
+
+	wrong := models.LoginRequest{Email: "eve@example.com", Password: "wrong-password"}
+	for i := 0; i < 3; i++ {
+		w := doJSON(g, http.MethodPost, "/api/auth/login", wrong, "")
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeInvalidCredentials {
+			t.Fatalf("attempt %d: expected invalid credentials, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	right := models.LoginRequest{Email: "eve@example.com", Password: "password123"}
+	w := doJSON(g, http.MethodPost, "/api/auth/login", right, "")
+	if w.Code != http.StatusLocked || errorCode(t, w) != controllers.CodeAccountLocked {
+		t.Fatalf("expected account to be locked, got %d: %s", w.Code, w.Body.String())
+	}
+
+	unlock := lastEmailTo(t, "eve@example.com")
+	if w := doJSON(g, http.MethodPost, "/api/auth/unlock", models.UnlockAccountRequest{Token: linkToken(t, unlock)}, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected unlock to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/unlock", models.UnlockAccountRequest{Token: linkToken(t, unlock)}, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected unlock token to be single use, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", right, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected login after unlock, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLoginProgressiveBackoff(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("LOGIN_BACKOFF_BASE_SECONDS", "60")
+	t.Setenv("LOGIN_BACKOFF_MAX_SECONDS", "300")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "mallory@example.com", "password123")
+
+	doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "mallory@example.com", Password: "nope"}, "")
+	w := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "mallory@example.com", Password: "password123"}, "")
+	if w.Code != http.StatusTooManyRequests || errorCode(t, w) != controllers.CodeLoginThrottled {
+		t.Fatalf("expected throttled login, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestResetOTPInvalidatedAfterWrongGuesses(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("OTP_MAX_ATTEMPTS", "2")
+	t.Setenv("RATE_LIMIT_EMAIL_PER_HOUR", "100")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "otto@example.com", "password123")
+
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", gin.H{"email": "otto@example.com"}, "")
+	otp := otpPattern.FindString(lastEmailTo(t, "otto@example.com").Text)
+	wrong := "000000"
+	if otp == wrong {
+		wrong = "111111"
+	}
+
+	w := doJSON(g, http.MethodPost, "/api/auth/verify-otp", gin.H{"email": "otto@example.com", "otp": wrong}, "")
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != controllers.CodeOTPInvalid {
+		t.Fatalf("expected invalid OTP, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/verify-otp", gin.H{"email": "otto@example.com", "otp": wrong}, "")
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != controllers.CodeOTPAttemptsExceeded {
+		t.Fatalf("expected OTP to be invalidated, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/verify-otp", gin.H{"email": "otto@example.com", "otp": otp}, "")
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != controllers.CodeOTPInvalid {
+		t.Fatalf("expected invalidated OTP to stay unusable, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// guesses sent at once cannot share attempts
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", gin.H{"email": "otto@example.com"}, "")
+	otp = otpPattern.FindString(lastEmailTo(t, "otto@example.com").Text)
+	if otp == wrong {
+		wrong = "222222"
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doJSON(g, http.MethodPost, "/api/auth/verify-otp", gin.H{"email": "otto@example.com", "otp": wrong}, "")
+		}()
+	}
+	wg.Wait()
+	var record models.PasswordResetRequest
+	database.DB.Order("id DESC").First(&record)
+	if record.Attempts != 2 || record.InvalidatedAt == nil {
+		t.Fatalf("expected the OTP to be used up after two guesses, got %d attempts", record.Attempts)
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/verify-otp", gin.H{"email": "otto@example.com", "otp": otp}, "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the used up OTP to stay unusable, got %d: %s", w.Code, w.Body.String())
+	}
+}
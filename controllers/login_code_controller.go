@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// purposeLoginOTP scopes login code hashes, so a password reset OTP can never
+// be used to sign in and vice versa.
+const purposeLoginOTP = "login_otp"
+
+// sendLoginCode replaces any outstanding login code of user with a new one and
+// emails it.
+func sendLoginCode(c *gin.Context, user models.User) error {
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return err
+	}
+
+	ttl := config.GetenvInt("LOGIN_OTP_TTL_MINUTES", 10)
+	now := time.Now()
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.LoginCode{}).
+			Where("user_id = ? AND consumed_at IS NULL AND invalidated_at IS NULL", user.ID).
+			Update("invalidated_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.LoginCode{
+			UserID:    user.ID,
+			CodeHash:  utils.HashSecret(purposeLoginOTP, code),
+			ExpiresAt: now.Add(time.Duration(ttl) * time.Minute),
+		}).Error; err != nil {
+			return err
+		}
+		return queueSecretEmail(tx, c, user, mail.TemplateLoginCode, mail.Data{"Code": code, "ExpiresMinutes": ttl}, time.Duration(ttl)*time.Minute)
+	})
+}
+
+// RequestLoginCode emails a one-time sign-in code. The response is the same
+// whether or not the account exists.
+func RequestLoginCode(c *gin.Context) {
+	var input models.LoginCodeRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	sendIfAccountExists(c, input.Email, gin.H{"message": "If the email exists, a sign-in code has been sent"}, func(user models.User) error {
+		if user.IsDisabled() {
+			return nil
+		}
+		return sendLoginCode(c, user)
+	})
+}
+
+// LoginWithCode signs the user in with an emailed code, answering like Login
+// and refusing it in the same cases. A code is invalidated after
+// OTP_MAX_ATTEMPTS wrong guesses (0 disables the limit).
+func LoginWithCode(c *gin.Context) {
+	var input models.LoginWithCodeRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	invalid := func(code string) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired code", "code": code})
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		invalid(codeOTPInvalid)
+		return
+	}
+	// before the guess is counted, so a refused login leaves the code usable
+	if !passwordlessLoginAllowed(c, withEmailProven(user), len(mfaMethods(user)) > 0) {
+		return
+	}
+
+	now := time.Now()
+	var record models.LoginCode
+	err := database.DB.Where("user_id = ? AND consumed_at IS NULL AND invalidated_at IS NULL", user.ID).
+		Order("id DESC").First(&record).Error
+	if err != nil {
+		invalid(codeOTPInvalid)
+		return
+	}
+	if now.After(record.ExpiresAt) {
+		invalid(codeOTPExpired)
+		return
+	}
+
+	// count the guess before looking at it, so concurrent guesses cannot
+	// share one attempt
+	maxAttempts := config.GetenvInt("OTP_MAX_ATTEMPTS", 5)
+	attempt := database.DB.Model(&models.LoginCode{}).
+		Where("id = ? AND consumed_at IS NULL AND invalidated_at IS NULL", record.ID)
+	if maxAttempts > 0 {
+		attempt = attempt.Where("attempts < ?", maxAttempts)
+	}
+	res := attempt.UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		invalid(codeOTPInvalid)
+		return
+	}
+
+	if !utils.SecretMatches(purposeLoginOTP, input.OTP, record.CodeHash) {
+		if maxAttempts > 0 {
+			spent := database.DB.Model(&models.LoginCode{}).
+				Where("id = ? AND attempts >= ? AND invalidated_at IS NULL", record.ID, maxAttempts).
+				Update("invalidated_at", now)
+			if spent.RowsAffected > 0 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "too many wrong codes, request a new one", "code": codeOTPAttemptsExceeded})
+				return
+			}
+		}
+		invalid(codeOTPInvalid)
+		return
+	}
+
+	// claim the code so it can only be used once
+	res = database.DB.Model(&models.LoginCode{}).
+		Where("id = ? AND consumed_at IS NULL AND invalidated_at IS NULL", record.ID).
+		Update("consumed_at", now)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		invalid(codeOTPInvalid)
+		return
+	}
+
+	// receiving the code proves the email address
+	if !user.IsEmailVerified() {
+		if err := database.DB.Model(&user).Update("email_verified_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+			return
+		}
+	}
+
+	completeLogin(c, user)
+}
@@ -0,0 +1,132 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+func TestLoginWithEmailedCode(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("OTP_MAX_ATTEMPTS", "2")
+	// the guesses below are more than the per-email limit allows
+	t.Setenv("RATE_LIMIT_EMAIL_PER_HOUR", "100")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "cody@example.com", "password123")
+
+	requestCode := func() string {
+		t.Helper()
+		w := doJSON(g, http.MethodPost, "/api/auth/otp/request", models.LoginCodeRequest{Email: "cody@example.com"}, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return otpPattern.FindString(lastEmailTo(t, "cody@example.com").Text)
+	}
+	login := func(otp string) int {
+		return doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "cody@example.com", OTP: otp}, "").Code
+	}
+
+	// a password reset OTP is not a login code
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "cody@example.com"}, "")
+	resetOTP := otpPattern.FindString(lastEmailTo(t, "cody@example.com").Text)
+	if code := login(resetOTP); code != http.StatusUnauthorized {
+		t.Fatalf("expected reset OTP to be rejected, got %d", code)
+	}
+
+	first := requestCode()
+	second := requestCode()
+	if first != second && login(first) != http.StatusUnauthorized {
+		t.Fatalf("expected a superseded code to be rejected")
+	}
+
+	w := doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "cody@example.com", OTP: second}, "")
+	auth := decodeAuthData(t, w)
+	if auth.Token == "" || auth.User.Email != "cody@example.com" {
+		t.Fatalf("unexpected auth data: %+v", auth)
+	}
+	if code := login(second); code != http.StatusUnauthorized {
+		t.Fatalf("expected a used code to be rejected, got %d", code)
+	}
+
+	// wrong guesses use up the code
+	otp := requestCode()
+	wrong := "000000"
+	if otp == wrong {
+		wrong = "111111"
+	}
+	login(wrong)
+	w = doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "cody@example.com", OTP: wrong}, "")
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeOTPAttemptsExceeded {
+		t.Fatalf("expected code to be invalidated, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := login(otp); code != http.StatusUnauthorized {
+		t.Fatalf("expected invalidated code to stay unusable, got %d", code)
+	}
+
+	// guesses sent at once cannot share attempts
+	otp = requestCode()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			login(wrong)
+		}()
+	}
+	wg.Wait()
+	var record models.LoginCode
+	database.DB.Order("id DESC").First(&record)
+	if record.Attempts != 2 || record.InvalidatedAt == nil {
+		t.Fatalf("expected the code to be used up after two guesses, got %d attempts", record.Attempts)
+	}
+	if code := login(otp); code != http.StatusUnauthorized {
+		t.Fatalf("expected the used up code to stay unusable, got %d", code)
+	}
+
+	// and so does time
+	otp = requestCode()
+	database.DB.Model(&models.LoginCode{}).Where("consumed_at IS NULL AND invalidated_at IS NULL").Update("expires_at", time.Now().Add(-time.Second))
+	w = doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "cody@example.com", OTP: otp}, "")
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeOTPExpired {
+		t.Fatalf("expected expired code, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLoginCodeAppliesLoginGates(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "gail@example.com", "password123")
+
+	doJSON(g, http.MethodPost, "/api/auth/otp/request", models.LoginCodeRequest{Email: "gail@example.com"}, "")
+	otp := otpPattern.FindString(lastEmailTo(t, "gail@example.com").Text)
+	login := func() *httptest.ResponseRecorder {
+		return doJSON(g, http.MethodPost, "/api/auth/otp/login", models.LoginWithCodeRequest{Email: "gail@example.com", OTP: otp}, "")
+	}
+	update := func(column string, value interface{}) {
+		database.DB.Model(&models.User{}).Where("email = ?", "gail@example.com").Update(column, value)
+	}
+
+	update("locked_until", time.Now().Add(time.Hour))
+	if w := login(); w.Code != http.StatusLocked || errorCode(t, w) != controllers.CodeAccountLocked {
+		t.Fatalf("expected a locked account to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	update("locked_until", nil)
+
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "90")
+	update("password_changed_at", time.Now().AddDate(0, 0, -91))
+	if w := login(); w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordExpired {
+		t.Fatalf("expected an expired password to be enforced, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the refusals did not use up the code
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "0")
+	if auth := decodeAuthData(t, login()); auth.Token == "" {
+		t.Fatal("expected tokens once nothing stands in the way")
+	}
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func sendMagicLink(c *gin.Context, user models.User, deviceToken string) error {
+	ttl := config.GetenvInt("MAGIC_LINK_TTL_MINUTES", 15)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := createBoundActionToken(tx, user.ID, models.PurposeMagicLink, time.Duration(ttl)*time.Minute, deviceToken)
+		if err != nil {
+			return err
+		}
+
+		link := config.AppURL("/magic-link?token=" + url.QueryEscape(token))
+		return queueSecretEmail(tx, c, user, mail.TemplateMagicLink, mail.Data{"Link": link, "ExpiresMinutes": ttl}, time.Duration(ttl)*time.Minute)
+	})
+}
+
+// RequestMagicLink emails a single-use sign-in link. The response is the same
+// whether or not the account exists. With bind_device, it also carries a
+// device_token without which the link cannot be used, so a link opened on
+// another device, or intercepted, is worthless.
+func RequestMagicLink(c *gin.Context) {
+	var input models.MagicLinkRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	response := gin.H{"message": "If the email exists, a sign-in link has been sent"}
+	var deviceToken string
+	if input.BindDevice {
+		// issued for unknown emails too, so it gives nothing away
+		var err error
+		if deviceToken, err = utils.RandomToken(32); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create sign-in link"})
+			return
+		}
+		response["device_token"] = deviceToken
+	}
+
+	sendIfAccountExists(c, input.Email, response, func(user models.User) error {
+		if user.IsDisabled() {
+			return nil
+		}
+		return sendMagicLink(c, user, deviceToken)
+	})
+}
+
+// ConsumeMagicLink signs the user in with the token from a magic link,
+// answering like Login and refusing it in the same cases: a locked or
+// throttled account, a required reset or an expired password. A refused link
+// stays unused. Opening the link also proves the email address.
+func ConsumeMagicLink(c *gin.Context) {
+	var input models.ConsumeMagicLinkRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	invalidLink := func(err error) {
+		if errors.Is(err, errInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired sign-in link"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		}
+	}
+
+	record, err := findBoundActionToken(models.PurposeMagicLink, input.Token, input.DeviceToken)
+	if err != nil {
+		invalidLink(err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, record.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired sign-in link"})
+		return
+	}
+
+	if !passwordlessLoginAllowed(c, withEmailProven(user), len(mfaMethods(user)) > 0) {
+		return
+	}
+
+	if err := claimActionToken(record); err != nil {
+		invalidLink(err)
+		return
+	}
+
+	if !user.IsEmailVerified() {
+		now := time.Now()
+		if err := database.DB.Model(&user).Update("email_verified_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+			return
+		}
+	}
+
+	completeLogin(c, user)
+}
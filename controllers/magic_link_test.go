@@ -0,0 +1,136 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "mia@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: "mia@example.com"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	known := w.Body.String()
+	token := linkToken(t, lastEmailTo(t, "mia@example.com"))
+
+	// an unknown address gets the same answer
+	w = doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: "nobody@example.com"}, "")
+	if w.Code != http.StatusOK || w.Body.String() != known {
+		t.Fatalf("expected the same response for an unknown email, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(g, http.MethodPost, "/api/auth/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token}, "")
+	auth := decodeAuthData(t, w)
+	if auth.Token == "" || auth.RefreshToken == "" || auth.User.Email != "mia@example.com" || !auth.User.EmailVerified {
+		t.Fatalf("unexpected auth data: %+v", auth)
+	}
+
+	// single use
+	if w := doJSON(g, http.MethodPost, "/api/auth/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token}, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used link to be rejected, got %d", w.Code)
+	}
+}
+
+func TestMagicLinkBoundToDevice(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "dev@example.com", "password123")
+
+	w := doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: "dev@example.com", BindDevice: true}, "")
+	var resp struct {
+		DeviceToken string `json:"device_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.DeviceToken == "" {
+		t.Fatalf("expected a device token, got %d: %s", w.Code, w.Body.String())
+	}
+	token := linkToken(t, lastEmailTo(t, "dev@example.com"))
+
+	for _, device := range []string{"", "some-other-device"} {
+		w := doJSON(g, http.MethodPost, "/api/auth/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token, DeviceToken: device}, "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected link to be refused on another device, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// the wrong device did not use up the link
+	w = doJSON(g, http.MethodPost, "/api/auth/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token, DeviceToken: resp.DeviceToken}, "")
+	if auth := decodeAuthData(t, w); auth.Token == "" {
+		t.Fatalf("expected tokens, got %s", w.Body.String())
+	}
+
+	// unknown accounts get a device token too, and mail failures are not reported
+	sentMail.Err = errors.New("smtp down")
+	for _, email := range []string{"dev@example.com", "nobody@example.com"} {
+		w := doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: email, BindDevice: true}, "")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil || resp.DeviceToken == "" {
+			t.Fatalf("%s: expected 200 with a device token, got %d: %s", email, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMagicLinkAppliesLoginGates(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	registerAndLogin(t, g, "gate@example.com", "password123")
+
+	// one link, refused until nothing stands in the way
+	doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: "gate@example.com"}, "")
+	token := linkToken(t, lastEmailTo(t, "gate@example.com"))
+	consume := func() *httptest.ResponseRecorder {
+		return doJSON(g, http.MethodPost, "/api/auth/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token}, "")
+	}
+	update := func(column string, value interface{}) {
+		database.DB.Model(&models.User{}).Where("email = ?", "gate@example.com").Update(column, value)
+	}
+
+	update("locked_until", time.Now().Add(time.Hour))
+	if w := consume(); w.Code != http.StatusLocked || errorCode(t, w) != controllers.CodeAccountLocked {
+		t.Fatalf("expected a locked account to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	update("locked_until", nil)
+
+	update("password_reset_required", true)
+	if w := consume(); w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordResetRequired {
+		t.Fatalf("expected a required reset to be enforced, got %d: %s", w.Code, w.Body.String())
+	}
+	update("password_reset_required", false)
+
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "90")
+	update("password_changed_at", time.Now().AddDate(0, 0, -91))
+	if w := consume(); w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordExpired {
+		t.Fatalf("expected an expired password to be enforced, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the refusals neither used the link nor verified the address
+	var user models.User
+	database.DB.Where("email = ?", "gate@example.com").First(&user)
+	if user.IsEmailVerified() {
+		t.Fatal("expected a refused link not to verify the email")
+	}
+
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "0")
+	if auth := decodeAuthData(t, consume()); auth.Token == "" || !auth.User.EmailVerified {
+		t.Fatalf("expected tokens and a verified email once nothing stands in the way, got %+v", auth)
+	}
+
+	// a link still proves the address where verification is required
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+	update("email_verified_at", nil)
+	doJSON(g, http.MethodPost, "/api/auth/magic-link", models.MagicLinkRequest{Email: "gate@example.com"}, "")
+	token = linkToken(t, lastEmailTo(t, "gate@example.com"))
+	if auth := decodeAuthData(t, consume()); auth.Token == "" {
+		t.Fatal("expected the link to sign an unverified account in")
+	}
+}
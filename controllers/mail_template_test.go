@@ -0,0 +1,67 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+func TestEmailLocale(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	auth := registerAndLogin(t, g, "lea@example.com", "password123")
+
+	forgotPassword := func(acceptLanguage string) {
+		t.Helper()
+		b, _ := json.Marshal(models.ForgotPasswordRequest{Email: "lea@example.com"})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/forgot-password", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// without a preference the request's language is used, down to its base language
+	forgotPassword("fr-CA,en;q=0.8")
+	msg := lastEmailTo(t, "lea@example.com")
+	if !strings.Contains(msg.Subject, "réinitialisation") || !strings.Contains(msg.HTML, `lang="fr"`) {
+		t.Fatalf("expected a French email with an HTML part, got %q: %s", msg.Subject, msg.HTML)
+	}
+	if otpPattern.FindString(msg.Text) == "" || !strings.Contains(msg.HTML, otpPattern.FindString(msg.Text)) {
+		t.Fatalf("expected the OTP in both parts: %s", msg.Text)
+	}
+
+	forgotPassword("de-DE")
+	if msg := lastEmailTo(t, "lea@example.com"); msg.Subject != "Your password reset code" {
+		t.Fatalf("expected English for an unsupported language, got %q", msg.Subject)
+	}
+
+	// a saved preference beats the request's language
+	if w := doJSON(g, http.MethodPut, "/api/me", map[string]string{"locale": "xx"}, auth.Token); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unsupported locale to be rejected, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPut, "/api/me", map[string]string{"locale": "fr"}, auth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	forgotPassword("en-US")
+	if msg := lastEmailTo(t, "lea@example.com"); !strings.Contains(msg.Subject, "réinitialisation") {
+		t.Fatalf("expected the user's locale to win, got %q", msg.Subject)
+	}
+
+	// a password change is followed by an alert
+	w := doJSON(g, http.MethodPost, "/api/change-password", models.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "password456"}, auth.Token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if msg := lastEmailTo(t, "lea@example.com"); msg.Subject != "Votre mot de passe a été modifié" {
+		t.Fatalf("expected a password change alert, got %q", msg.Subject)
+	}
+}
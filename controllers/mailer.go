@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/outbox"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// queueEmail renders the email template name for user, in their preferred
+// language or else the one the request c accepts, and adds it to the outbox
+// through tx. Callers pass the transaction that makes the change the email
+// reports, so it is only sent if that change is committed. c may be nil when
+// the email is not a reply to the user's own request.
+func queueEmail(tx *gorm.DB, c *gin.Context, user models.User, name string, data mail.Data) error {
+	return queueSecretEmail(tx, c, user, name, data, 0)
+}
+
+// queueSecretEmail is queueEmail for an email carrying a code or link that
+// stops working after ttl. The outbox erases the message if it is still
+// undelivered by then.
+func queueSecretEmail(tx *gorm.DB, c *gin.Context, user models.User, name string, data mail.Data, ttl time.Duration) error {
+	templates := mail.TemplatesFromEnv()
+	preferences := []string{user.Locale}
+	if c != nil {
+		preferences = append(preferences, c.GetHeader("Accept-Language"))
+	}
+	if data == nil {
+		data = mail.Data{}
+	}
+	if _, ok := data["Name"]; !ok {
+		data["Name"] = user.FirstName
+	}
+
+	msg, err := templates.Render(name, templates.MatchLocale(preferences...), data)
+	if err != nil {
+		return err
+	}
+	msg.To = user.Email
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	return outbox.Enqueue(tx, user.ID, name, msg, expiresAt)
+}
+
+// Events the security_alert template describes.
+const (
+	securityEventAccountLocked        = "account_locked"
+	securityEventPasswordChanged      = "password_changed"
+	securityEventEmailChangeRequested = "email_change_requested"
+	securityEventEmailChanged         = "email_changed"
+)
+
+// queuePasswordChangedAlert tells user through tx that their password
+// changed. A failure is only logged and does not undo the change.
+func queuePasswordChangedAlert(tx *gorm.DB, c *gin.Context, user models.User) {
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		return queueEmail(tx, c, user, mail.TemplateSecurityAlert, mail.Data{
+			"Event": securityEventPasswordChanged,
+			"Time":  time.Now().UTC().Format(time.RFC1123),
+		})
+	})
+	if err != nil {
+		log.Println("failed to queue password change alert:", err)
+	}
+}
@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeAlphabet avoids characters that are easily confused when typed.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// loadCurrentUser fetches the authenticated user, writing an error response if
+// that is not possible.
+func loadCurrentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return user, false
+	}
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// appName is the product name shown in authenticator apps and passkey prompts.
+func appName() string {
+	if name := config.Getenv("APP_NAME"); name != "" {
+		return name
+	}
+	return "JWT Authentication"
+}
+
+// mfaMethods lists the second factors available to user; empty means MFA is off.
+func mfaMethods(user models.User) []string {
+	var methods []string
+	if user.HasTOTP() {
+		methods = append(methods, models.MFAMethodTOTP, models.MFAMethodRecoveryCode)
+	}
+	var passkeys int64
+	database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&passkeys)
+	if passkeys > 0 {
+		methods = append(methods, models.MFAMethodWebAuthn)
+	}
+	return methods
+}
+
+// respondWithMFAChallenge returns a short-lived challenge token in place of AuthData.
+func respondWithMFAChallenge(c *gin.Context, user models.User, methods []string) {
+	challenge, err := utils.GenerateChallengeToken(
+		utils.TokenSubject{UserID: user.ID, TokenVersion: user.TokenVersion},
+		utils.PurposeMFA,
+		mfaChallengeTTL,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = http.StatusOK
+	response.Success.Message = "mfa_required"
+	response.Success.Data = models.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    challenge.Token,
+		Methods:     methods,
+		ExpiresAt:   challenge.ExpiresAt.Format(time.RFC3339),
+
+		PasswordExpired: passwordExpired(user),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// verifyTOTPCode checks code against the user's authenticator and records the
+// matched step so the same code cannot be used twice.
+func verifyTOTPCode(user models.User, code string) bool {
+	secret, err := utils.DecryptSecret(user.TOTPSecret)
+	if err != nil {
+		log.Println("failed to decrypt TOTP secret:", err)
+		return false
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false
+	}
+	res := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes.
+func useRecoveryCode(userID uint, code string) bool {
+	hash := utils.HashSecret(models.MFAMethodRecoveryCode, normalizeRecoveryCode(code))
+	res := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and returns a new set.
+func replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j, b := range raw {
+			raw[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashSecret(models.MFAMethodRecoveryCode, normalizeRecoveryCode(codes[i])),
+		}
+	}
+
+	if err := database.DB.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrollTOTP starts TOTP enrollment by generating a secret for the user's
+// authenticator app. MFA is not enforced until ConfirmTOTP succeeds.
+func EnrollTOTP(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.HasTOTP() {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	encrypted, err := utils.EncryptSecret(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": encrypted, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(appName(), user.Email, secret),
+	})
+}
+
+// ConfirmTOTP enables TOTP once the user proves their app produces valid codes,
+// and returns the recovery codes. They are shown only once.
+func ConfirmTOTP(c *gin.Context) {
+	var input models.TOTPConfirmRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.HasTOTP() {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start enrollment first"})
+		return
+	}
+	if !verifyTOTPCode(user, input.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := database.DB.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns TOTP off. It needs the password and a current second factor.
+func DisableTOTP(c *gin.Context) {
+	var input models.TOTPDisableRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.HasTOTP() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if ok, err := password.Verify(input.Password, user.PasswordHash); err != nil || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+	if !verifySecondFactor(user, input.Code, input.RecoveryCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// verifySecondFactor accepts either a TOTP code or a recovery code.
+func verifySecondFactor(user models.User, code, recoveryCode string) bool {
+	switch {
+	case code != "":
+		return verifyTOTPCode(user, code)
+	case recoveryCode != "":
+		return useRecoveryCode(user.ID, recoveryCode)
+	}
+	return false
+}
+
+// VerifyMFA exchanges an MFA challenge token and a second factor for AuthData.
+// Wrong factors count as failed logins, and the challenge is revoked once the
+// account has MFA_MAX_ATTEMPTS (default 3, 0 to disable) of them in a row.
+func VerifyMFA(c *gin.Context) {
+	var input models.MFAVerifyRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	claims, err := utils.ParseChallengeToken(input.MFAToken, utils.PurposeMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	if revoked, err := utils.IsTokenRevoked(claims); err != nil || revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID).Error; err != nil || len(mfaMethods(user)) == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	if loginBlocked(c, user) {
+		return
+	}
+
+	// an expired password is replaced here, once the second factor is in; the
+	// new one is checked first so a rejected password does not use up a code
+	expired := passwordExpired(user)
+	if expired {
+		if input.NewPassword == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password has expired; verify again with a new_password", "code": codePasswordExpired})
+			return
+		}
+		if !checkPasswordPolicy(c, input.NewPassword, user) {
+			return
+		}
+	}
+
+	var verified bool
+	if input.SessionID != "" {
+		verified = verifyWebAuthnAssertion(user, input.SessionID, input.Credential)
+	} else {
+		verified = user.HasTOTP() && verifySecondFactor(user, input.Code, input.RecoveryCode)
+	}
+	if !verified {
+		failures := recordLoginFailure(c, user)
+		if maxAttempts := config.GetenvInt("MFA_MAX_ATTEMPTS", 3); maxAttempts > 0 && failures >= maxAttempts {
+			if err := utils.RevokeToken(claims); err != nil {
+				log.Println("failed to revoke mfa token:", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "too many wrong codes, sign in again", "code": codeMFAAttemptsExceeded})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		clearLoginFailures(user.ID)
+	}
+
+	// the challenge is single use
+	if err := utils.RevokeToken(claims); err != nil {
+		log.Println("failed to revoke mfa token:", err)
+	}
+	if expired && !replaceExpiredPassword(c, &user, input.NewPassword) {
+		return
+	}
+
+	respondWithAuth(c, http.StatusOK, "Login successful", user, true)
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/outbox"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func outboxMessageResponse(msg models.OutboxMessage) models.OutboxMessageResponse {
+	return models.OutboxMessageResponse{
+		ID:            msg.ID,
+		Template:      msg.Template,
+		To:            msg.ToAddress,
+		Subject:       msg.Subject,
+		Status:        msg.Status,
+		Attempts:      msg.Attempts,
+		LastError:     msg.LastError,
+		NextAttemptAt: msg.NextAttemptAt.Format(time.RFC3339),
+		CreatedAt:     msg.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListOutboxMessages pages through queued email. By default it lists the dead
+// messages; status=failing lists those still being retried after a failure,
+// and pending, sent or all can also be asked for.
+func ListOutboxMessages(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultUsersPerPage)))
+	if perPage < 1 || perPage > maxUsersPerPage {
+		perPage = defaultUsersPerPage
+	}
+
+	query := database.DB.Model(&models.OutboxMessage{})
+	switch c.DefaultQuery("status", models.OutboxDead) {
+	case models.OutboxDead, models.OutboxPending, models.OutboxSent:
+		query = query.Where("status = ?", c.DefaultQuery("status", models.OutboxDead))
+	case "failing":
+		query = query.Where("status IN ? AND last_error <> ''", []string{models.OutboxPending, models.OutboxSending})
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be dead, failing, pending, sent or all"})
+		return
+	}
+
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list messages"})
+		return
+	}
+	// the bodies are never listed, even encrypted
+	var messages []models.OutboxMessage
+	if err := query.Omit("text_body", "html_body").Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not list messages"})
+		return
+	}
+
+	list := models.OutboxMessageList{Messages: make([]models.OutboxMessageResponse, 0, len(messages)), Page: page, PerPage: perPage, Total: total}
+	for _, msg := range messages {
+		list.Messages = append(list.Messages, outboxMessageResponse(msg))
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = http.StatusOK
+	response.Success.Message = "Outbox messages"
+	response.Success.Data = list
+	c.JSON(http.StatusOK, response)
+}
+
+// RequeueOutboxMessage retries a failing message now, with a fresh set of
+// delivery attempts.
+func RequeueOutboxMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	switch err := outbox.Requeue(database.DB, uint(id)); {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+	case errors.Is(err, outbox.ErrNotFailing):
+		c.JSON(http.StatusConflict, gin.H{"error": "only messages waiting to retry a failed delivery can be requeued"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not requeue message"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "message requeued"})
+	}
+}
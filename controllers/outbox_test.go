@@ -0,0 +1,125 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+func TestOutboxRetriesAndRequeue(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	admin := loginAdmin(t, g, "root@example.com")
+	registerAndLogin(t, g, "ola@example.com", "password123")
+	deliverMail(t)
+
+	// a failing mailer no longer fails the request
+	sentMail.Err = errors.New("resend unavailable")
+	if w := doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "ola@example.com"}, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var msg models.OutboxMessage
+	database.DB.Where("to_address = ?", "ola@example.com").Order("id DESC").First(&msg)
+	if msg.Status != models.OutboxPending || msg.Template != "password_reset" {
+		t.Fatalf("expected the reset email to be queued, got %+v", msg)
+	}
+	if msg.TextBody == "" || strings.Contains(msg.TextBody, "password") {
+		t.Fatalf("expected the body to be stored encrypted, got %q", msg.TextBody)
+	}
+
+	// each failure is retried later, waiting longer each time, until the attempts run out
+	var wait time.Duration
+	for attempt := 1; attempt <= mailWorker.MaxAttempts; attempt++ {
+		deliverMail(t)
+		database.DB.First(&msg, msg.ID)
+		if msg.Attempts != attempt || msg.LastError != "resend unavailable" {
+			t.Fatalf("attempt %d: unexpected attempts %d, error %q", attempt, msg.Attempts, msg.LastError)
+		}
+		if attempt < mailWorker.MaxAttempts {
+			next := time.Until(msg.NextAttemptAt)
+			if next <= wait {
+				t.Fatalf("attempt %d: expected a longer wait than %v, got %v", attempt, wait, next)
+			}
+			wait = next
+			deliverMail(t) // not due yet
+			if database.DB.First(&msg, msg.ID); msg.Attempts != attempt {
+				t.Fatalf("attempt %d: retried too early", attempt)
+			}
+			database.DB.Model(&msg).Update("next_attempt_at", time.Now())
+		}
+	}
+	if msg.Status != models.OutboxDead || msg.TextBody != "" || msg.HTMLBody != "" {
+		t.Fatalf("expected the message to be dead without its body, got %+v", msg)
+	}
+
+	list := func(status string) models.OutboxMessageList {
+		t.Helper()
+		w := doJSON(g, http.MethodGet, "/api/admin/outbox?status="+status, nil, admin.Token)
+		var resp struct {
+			Success struct {
+				Data models.OutboxMessageList `json:"data"`
+			} `json:"success"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("expected 200 listing the outbox, got %d: %s", w.Code, w.Body.String())
+		}
+		return resp.Success.Data
+	}
+	if dead := list(models.OutboxDead); dead.Total != 1 || dead.Messages[0].ID != msg.ID || dead.Messages[0].To != "ola@example.com" {
+		t.Fatalf("expected the dead message to be listed, got %+v", dead)
+	}
+	requeue := fmt.Sprintf("/api/admin/outbox/%d/requeue", msg.ID)
+	if w := doJSON(g, http.MethodPost, requeue, nil, admin.Token); w.Code != http.StatusConflict {
+		t.Fatalf("expected a dead message not to be requeued, got %d", w.Code)
+	}
+
+	// a message still being retried is requeued after the outage, and delivered
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "ola@example.com"}, "")
+	deliverMail(t)
+	if failing := list("failing"); failing.Total != 1 {
+		t.Fatalf("expected one failing message, got %+v", failing)
+	} else {
+		msg.ID = failing.Messages[0].ID
+	}
+	sentMail.Err = nil
+	requeue = fmt.Sprintf("/api/admin/outbox/%d/requeue", msg.ID)
+	if w := doJSON(g, http.MethodPost, requeue, nil, admin.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if otpPattern.FindString(lastEmailTo(t, "ola@example.com").Text) == "" {
+		t.Fatalf("expected the reset OTP to arrive")
+	}
+	database.DB.First(&msg, msg.ID)
+	if msg.Status != models.OutboxSent || msg.TextBody != "" || msg.HTMLBody != "" {
+		t.Fatalf("expected a sent message without its body, got %+v", msg)
+	}
+	if w := doJSON(g, http.MethodPost, requeue, nil, admin.Token); w.Code != http.StatusConflict {
+		t.Fatalf("expected a sent message not to be requeued, got %d", w.Code)
+	}
+
+	// a code that expired while waiting is never sent
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "ola@example.com"}, "")
+	msg = models.OutboxMessage{}
+	database.DB.Where("to_address = ?", "ola@example.com").Order("id DESC").First(&msg)
+	database.DB.Model(&msg).Update("expires_at", time.Now().Add(-time.Second))
+	before := len(sentMail.Messages())
+	deliverMail(t)
+	database.DB.First(&msg, msg.ID)
+	if len(sentMail.Messages()) != before || msg.Status != models.OutboxDead || msg.TextBody != "" || msg.LastError != "expired before delivery" {
+		t.Fatalf("expected the expired message to be given up on, got %+v", msg)
+	}
+
+	// only administrators see the outbox
+	user := registerAndLogin(t, g, "nosy@example.com", "password123")
+	if w := doJSON(g, http.MethodGet, "/api/admin/outbox", nil, user.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
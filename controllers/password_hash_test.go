@@ -0,0 +1,70 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func storedHash(t *testing.T, email string) string {
+	t.Helper()
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	return user.PasswordHash
+}
+
+func TestPasswordRehashOnLogin(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+
+	if hash := storedHash(t, registerAndLogin(t, g, "new@example.com", "password123").User.Email); !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=2$") {
+		t.Fatalf("expected new accounts to use argon2id, got %q", hash)
+	}
+
+	// an account created before argon2id, with a bcrypt hash
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	database.DB.Create(&models.User{FirstName: "Old", Email: "old@example.com", PasswordHash: string(legacy)})
+	login := models.LoginRequest{Email: "old@example.com", Password: "password123"}
+
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected legacy bcrypt hash to verify, got %d: %s", w.Code, w.Body.String())
+	}
+	upgraded := storedHash(t, "old@example.com")
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("expected bcrypt hash to be upgraded, got %q", upgraded)
+	}
+
+	// unchanged policy: no rehash
+	doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if storedHash(t, "old@example.com") != upgraded {
+		t.Fatalf("expected hash to be left alone when it meets the policy")
+	}
+
+	// raising the cost upgrades the hash at the next login
+	t.Setenv("ARGON2_ITERATIONS", "2")
+	doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if hash := storedHash(t, "old@example.com"); !strings.Contains(hash, ",t=2,") {
+		t.Fatalf("expected stronger argon2id parameters, got %q", hash)
+	}
+
+	// switching algorithm
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "scrypt")
+	doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if hash := storedHash(t, "old@example.com"); !strings.HasPrefix(hash, "$scrypt$ln=10,r=8,p=1$") {
+		t.Fatalf("expected scrypt hash, got %q", hash)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected scrypt hash to verify, got %d", w.Code)
+	}
+
+	login.Password = "wrong-password"
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected wrong password to be rejected, got %d", w.Code)
+	}
+}
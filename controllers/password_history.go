@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// passwordHistorySize is how many of a user's passwords, including the current
+// one, may not be chosen again. 0 turns the check off.
+func passwordHistorySize() int {
+	return config.GetenvInt("PASSWORD_HISTORY_SIZE", 5)
+}
+
+// passwordReused reports whether plain matches the user's current password or
+// one of their recent ones.
+func passwordReused(user models.User, plain string) (bool, error) {
+	size := passwordHistorySize()
+	if size <= 0 {
+		return false, nil
+	}
+
+	// the current hash covers accounts whose history predates the table
+	hashes := []string{user.PasswordHash}
+	var history []models.PasswordHistory
+	err := database.DB.Where("user_id = ?", user.ID).Order("id DESC").Limit(size).Find(&history).Error
+	if err != nil {
+		return false, err
+	}
+	for _, h := range history {
+		hashes = append(hashes, h.PasswordHash)
+	}
+
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		if ok, err := password.Verify(plain, hash); err == nil && ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPassword appends hash to the user's password history and drops
+// entries beyond the configured size.
+func recordPassword(tx *gorm.DB, userID uint, hash string) error {
+	size := passwordHistorySize()
+	if size <= 0 {
+		return nil
+	}
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: hash}).Error; err != nil {
+		return err
+	}
+	keep := tx.Model(&models.PasswordHistory{}).Select("id").Where("user_id = ?", userID).Order("id DESC").Limit(size)
+	return tx.Where("user_id = ? AND id NOT IN (?)", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// storePassword makes hash the user's password, along with any other column
+// updates in fields, and records it in the password history.
+func storePassword(tx *gorm.DB, userID uint, hash string, fields map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"password_hash":       hash,
+		"password_changed_at": time.Now(),
+	}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return recordPassword(tx, userID, hash)
+}
+
+// passwordExpired reports whether the user's password is older than
+// PASSWORD_MAX_AGE_DAYS. Accounts that never changed their password count
+// from when they were created.
+func passwordExpired(user models.User) bool {
+	days := config.GetenvInt("PASSWORD_MAX_AGE_DAYS", 0)
+	if days <= 0 {
+		return false
+	}
+	changed := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changed = *user.PasswordChangedAt
+	}
+	return time.Since(changed) > time.Duration(days)*24*time.Hour
+}
+
+// replaceExpiredPassword is the part of Login, or of VerifyMFA for accounts
+// with a second factor, that handles an expired password: the login is refused
+// unless it carries a new password, which is then stored in place of the old
+// one. user is updated to match.
+func replaceExpiredPassword(c *gin.Context, user *models.User, newPassword string) bool {
+	if !loginAllowed(c, *user) {
+		return false
+	}
+	if newPassword == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "password has expired; log in again with a new_password", "code": codePasswordExpired})
+		return false
+	}
+	if !checkPasswordPolicy(c, newPassword, *user) {
+		return false
+	}
+
+	hashed, err := password.Hash(newPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash new password"})
+		return false
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := storePassword(tx, user.ID, hashed, nil); err != nil {
+			return err
+		}
+		queuePasswordChangedAlert(tx, c, *user)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+		return false
+	}
+	if err := revokeAllUserTokens(user.ID); err != nil {
+		log.Println("failed to revoke tokens after password change:", err)
+	}
+
+	// the token version moved on with the revocation
+	if err := database.DB.First(user, user.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+)
+
+func TestPasswordHistoryPreventsReuse(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("PASSWORD_HISTORY_SIZE", "3")
+	g := setupTestServer(t)
+
+	auth := registerAndLogin(t, g, "hist@example.com", "first-pass-1")
+	change := func(current, next string) *http.Response {
+		w := doJSON(g, http.MethodPost, "/api/change-password", models.ChangePasswordRequest{CurrentPassword: current, NewPassword: next}, auth.Token)
+		if w.Code == http.StatusOK {
+			// the change revoked our tokens; log in again with the new password
+			w2 := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "hist@example.com", Password: next}, "")
+			auth = decodeAuthData(t, w2)
+		} else if got := strings.Join(violatedRules(t, w.Body.Bytes()), " "); got != "reused" {
+			t.Fatalf("expected a reused violation, got %q", got)
+		}
+		return w.Result()
+	}
+
+	if r := change("first-pass-1", "first-pass-1"); r.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the current password to be rejected, got %d", r.StatusCode)
+	}
+	if r := change("first-pass-1", "second-pass-2"); r.StatusCode != http.StatusOK {
+		t.Fatalf("expected change to succeed, got %d", r.StatusCode)
+	}
+	if r := change("second-pass-2", "third-pass-3"); r.StatusCode != http.StatusOK {
+		t.Fatalf("expected change to succeed, got %d", r.StatusCode)
+	}
+	if r := change("third-pass-3", "first-pass-1"); r.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a recent password to be rejected, got %d", r.StatusCode)
+	}
+	if r := change("third-pass-3", "fourth-pass-4"); r.StatusCode != http.StatusOK {
+		t.Fatalf("expected change to succeed, got %d", r.StatusCode)
+	}
+
+	// only the last three are kept, so the first password is allowed again
+	var kept int64
+	database.DB.Table("password_history").Where("user_id = ?", auth.User.ID).Count(&kept)
+	if kept != 3 {
+		t.Fatalf("expected 3 history entries, got %d", kept)
+	}
+
+	// a reset cannot reuse a recent password either
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "hist@example.com"}, "")
+	otp := otpPattern.FindString(lastEmailTo(t, "hist@example.com").Text)
+	token := verifyResetOTP(t, g, "hist@example.com", otp)
+	reset := models.ResetPasswordRequest{ResetToken: token, NewPassword: "third-pass-3", ConfirmPassword: "third-pass-3"}
+	w := doJSON(g, http.MethodPost, "/api/auth/reset-password", reset, "")
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "reused" {
+		t.Fatalf("expected reset to a recent password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	reset.NewPassword, reset.ConfirmPassword = "first-pass-1", "first-pass-1"
+	if w := doJSON(g, http.MethodPost, "/api/auth/reset-password", reset, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected reset to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExpiredPasswordMustBeChangedAtLogin(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "90")
+	g := setupTestServer(t)
+
+	registerAndLogin(t, g, "old@example.com", "aging-pass-1")
+	changed := time.Now().AddDate(0, 0, -91)
+	database.DB.Model(&models.User{}).Where("email = ?", "old@example.com").Update("password_changed_at", changed)
+
+	login := models.LoginRequest{Email: "old@example.com", Password: "aging-pass-1"}
+	w := doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	if w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordExpired {
+		t.Fatalf("expected password_expired, got %d: %s", w.Code, w.Body.String())
+	}
+
+	login.NewPassword = "aging-pass-1"
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", login, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the expired password to be rejected as the new one, got %d: %s", w.Code, w.Body.String())
+	}
+
+	login.NewPassword = "fresh-pass-2"
+	w = doJSON(g, http.MethodPost, "/api/auth/login", login, "")
+	auth := decodeAuthData(t, w)
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected the new tokens to work, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the new password works and is not expired
+	w = doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "old@example.com", Password: "fresh-pass-2"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected login with the new password, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExpiredPasswordWaitsForSecondFactor(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "90")
+	g := setupTestServer(t)
+
+	auth := registerAndLogin(t, g, "mfa-old@example.com", "aging-pass-1")
+	w := doJSON(g, http.MethodPost, "/api/me/mfa/totp/enroll", nil, auth.Token)
+	var enroll models.TOTPEnrollResponse
+	json.Unmarshal(w.Body.Bytes(), &enroll)
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(enroll.Secret, step)
+	if w := doJSON(g, http.MethodPost, "/api/me/mfa/totp/confirm", models.TOTPConfirmRequest{Code: code}, auth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected totp to be enabled, got %d: %s", w.Code, w.Body.String())
+	}
+	changed := time.Now().AddDate(0, 0, -91)
+	database.DB.Model(&models.User{}).Where("email = ?", "mfa-old@example.com").Update("password_changed_at", changed)
+
+	// the old password alone neither changes the password nor skips the challenge
+	login := models.LoginRequest{Email: "mfa-old@example.com", Password: "aging-pass-1", NewPassword: "fresh-pass-2"}
+	challenge := decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+	if !challenge.PasswordExpired {
+		t.Fatal("expected the challenge to ask for a new password")
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected existing sessions to survive, got %d", w.Code)
+	}
+	login.NewPassword = ""
+	decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", login, ""))
+
+	next, _ := utils.TOTPCode(enroll.Secret, step+1)
+	verify := models.MFAVerifyRequest{MFAToken: challenge.MFAToken, Code: next}
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", verify, "")
+	if w.Code != http.StatusForbidden || errorCode(t, w) != controllers.CodePasswordExpired {
+		t.Fatalf("expected password_expired, got %d: %s", w.Code, w.Body.String())
+	}
+	verify.NewPassword = "aging-pass-1"
+	if w := doJSON(g, http.MethodPost, "/api/auth/mfa/verify", verify, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the expired password to be rejected as the new one, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the code was not used up by the refusals above
+	verify.NewPassword = "fresh-pass-2"
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", verify, "")
+	if w.Code != http.StatusOK || decodeAuthData(t, w).Token == "" {
+		t.Fatalf("expected tokens after mfa, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected older sessions to be signed out, got %d", w.Code)
+	}
+	challenge = decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "mfa-old@example.com", Password: "fresh-pass-2"}, ""))
+	if challenge.PasswordExpired {
+		t.Fatal("expected the new password not to be expired")
+	}
+}
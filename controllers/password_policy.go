@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gin-gonic/gin"
+)
+
+// checkPasswordPolicy reports whether plain is an acceptable new password for
+// user. If not, it writes a 400 response listing every rule that failed. For
+// an existing user, recent passwords are rejected too.
+func checkPasswordPolicy(c *gin.Context, plain string, user models.User) bool {
+	policy, err := password.CurrentPolicy()
+	if err != nil {
+		log.Println("failed to load password policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check password"})
+		return false
+	}
+
+	account := password.Account{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName}
+	violations, err := policy.Check(plain, account)
+	if err != nil {
+		log.Println("failed to check breached passwords:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check password"})
+		return false
+	}
+	if user.ID != 0 {
+		reused, err := passwordReused(user, plain)
+		if err != nil {
+			log.Println("failed to check password history:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check password"})
+			return false
+		}
+		if reused {
+			violations = append(violations, password.Violation{Rule: password.RuleReused, Message: "must not be one of your recent passwords"})
+		}
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "password does not meet the requirements",
+			"code":       codePasswordPolicy,
+			"violations": violations,
+		})
+		return false
+	}
+	return true
+}
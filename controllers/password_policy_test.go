@@ -0,0 +1,195 @@
+package controllers_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+)
+
+// violatedRules returns the sorted rule names of a password policy rejection.
+func violatedRules(t *testing.T, body []byte) []string {
+	t.Helper()
+	var resp struct {
+		Code       string               `json:"code"`
+		Violations []password.Violation `json:"violations"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Code != controllers.CodePasswordPolicy {
+		t.Fatalf("expected a password policy error, got %s", body)
+	}
+	rules := make([]string, 0, len(resp.Violations))
+	for _, v := range resp.Violations {
+		rules = append(rules, v.Rule)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(blocklist, []byte("# local additions\nCompanyName2024!\n"), 0o600)
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", blocklist)
+	t.Setenv("PASSWORD_MIN_SCORE", "3")
+	t.Setenv("PASSWORD_MAX_LENGTH", "40")
+
+	register := func(pw string) (int, []byte) {
+		w := doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Grace", LastName: "Hopper", Email: "grace@example.com", Password: pw}, "")
+		return w.Code, w.Body.Bytes()
+	}
+
+	cases := []struct {
+		password string
+		rules    string
+	}{
+		{"abc", "min_length strength"},
+		{"password123", "strength"},
+		{"grace-Lovelace-1906!x", "contains_email contains_name"},
+		{"companyname2024!", "blocklisted"},
+		{strings.Repeat("x7#Lq", 10), "max_length"},
+	}
+	for _, tc := range cases {
+		code, body := register(tc.password)
+		if code != http.StatusBadRequest {
+			t.Fatalf("%q: expected 400, got %d: %s", tc.password, code, body)
+		}
+		if got := strings.Join(violatedRules(t, body), " "); got != tc.rules {
+			t.Fatalf("%q: expected rules %q, got %q", tc.password, tc.rules, got)
+		}
+	}
+
+	if code, body := register("vivid-Otter-tapes-91"); code != http.StatusCreated {
+		t.Fatalf("expected a strong password to be accepted, got %d: %s", code, body)
+	}
+
+	// the same policy applies when changing the password
+	w := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "grace@example.com", Password: "vivid-Otter-tapes-91"}, "")
+	auth := decodeAuthData(t, w)
+	w = doJSON(g, http.MethodPost, "/api/change-password", models.ChangePasswordRequest{CurrentPassword: "vivid-Otter-tapes-91", NewPassword: "qwerty123"}, auth.Token)
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "strength" {
+		t.Fatalf("expected weak new password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLongPasswordsAreCheckedQuickly(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	long := strings.Repeat("x7#Lq", 20000)
+
+	start := time.Now()
+	w := doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Long", Email: "long@example.com", Password: long}, "")
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "max_length" {
+		t.Fatalf("expected only max_length, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected an oversized password to be refused at once, took %v", elapsed)
+	}
+
+	// without a length limit the strength estimate still grows linearly
+	start = time.Now()
+	if score := password.Strength(long, "long@example.com"); score != 4 {
+		t.Fatalf("expected a long random password to score 4, got %d", score)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the strength of a 100k character password in seconds, took %v", elapsed)
+	}
+}
+
+func TestBcryptCapsPasswordsAt72Bytes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	g := setupTestServer(t)
+	register := func(email, pw string) *httptest.ResponseRecorder {
+		return doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Bea", Email: email, Password: pw}, "")
+	}
+
+	// 37 characters, but 74 bytes
+	w := register("bea@example.com", strings.Repeat("é", 37))
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "max_length" {
+		t.Fatalf("expected max_length, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := register("bea@example.com", strings.Repeat("é", 36)); w.Code != http.StatusCreated {
+		t.Fatalf("expected a 72 byte password to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// writeRangeCorpus lays passwords out in a temporary HIBP range directory.
+func writeRangeCorpus(t *testing.T, passwords ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i, pw := range passwords {
+		digest := sha1.Sum([]byte(pw))
+		hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+		f, err := os.OpenFile(filepath.Join(dir, hash[:5]), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(f, "%s:%d\r\n", hash[5:], i+1)
+		f.Close()
+	}
+	return dir
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	corpus := writeRangeCorpus(t, "Tr0ub4dor&3-horse", "never-Seen-but-rare", "linkedin-Leak-2012")
+
+	register := func(email, pw string) *httptest.ResponseRecorder {
+		return doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Ada", LastName: "Byron", Email: email, Password: pw}, "")
+	}
+
+	// range directory, ignoring entries seen only once
+	t.Setenv("PASSWORD_BREACH_CORPUS", corpus)
+	t.Setenv("PASSWORD_BREACH_MIN_COUNT", "2")
+	w := register("ada1@example.com", "linkedin-Leak-2012")
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "breached" {
+		t.Fatalf("expected breached password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := register("ada1@example.com", "Tr0ub4dor&3-horse"); w.Code != http.StatusCreated {
+		t.Fatalf("expected a password below the minimum count to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Bloom filter built from the same corpus
+	filter := password.NewBloomFilter(3, 0.0001)
+	if err := password.ReadCorpus(corpus, 1, filter.Add); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	f, _ := os.Create(path)
+	if _, err := filter.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	t.Setenv("PASSWORD_BREACH_CORPUS", path)
+
+	for _, pw := range []string{"Tr0ub4dor&3-horse", "never-Seen-but-rare", "linkedin-Leak-2012"} {
+		if w := register("ada2@example.com", pw); w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected filter to reject breached password, got %d: %s", pw, w.Code, w.Body.String())
+		}
+	}
+	if w := register("ada2@example.com", "vivid-Otter-tapes-91"); w.Code != http.StatusCreated {
+		t.Fatalf("expected unbreached password to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// and when changing the password
+	w = doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "ada2@example.com", Password: "vivid-Otter-tapes-91"}, "")
+	auth := decodeAuthData(t, w)
+	w = doJSON(g, http.MethodPost, "/api/change-password", models.ChangePasswordRequest{CurrentPassword: "vivid-Otter-tapes-91", NewPassword: "never-Seen-but-rare"}, auth.Token)
+	if w.Code != http.StatusBadRequest || strings.Join(violatedRules(t, w.Body.Bytes()), " ") != "breached" {
+		t.Fatalf("expected breached new password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/password"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HashSecret purposes, so an OTP hash can never be mistaken for a token hash.
+const (
+	purposeResetOTP   = "password_reset_otp"
+	purposeResetToken = "password_reset_token"
+)
+
+// maxActiveResetRequests bounds how many OTPs a user can have outstanding, and
+// so how many codes each guess is checked against.
+const maxActiveResetRequests = 3
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// activeResetRequests selects the requests of userID whose OTP can still be used.
+func activeResetRequests(tx *gorm.DB, userID uint, now time.Time) *gorm.DB {
+	return tx.Model(&models.PasswordResetRequest{}).
+		Where("user_id = ? AND verified_at IS NULL AND completed_at IS NULL AND invalidated_at IS NULL AND expires_at > ?", userID, now)
+}
+
+// invalidateResetRequests retires every outstanding request of userID, except
+// the one with id keep.
+func invalidateResetRequests(tx *gorm.DB, userID, keep uint) error {
+	return tx.Model(&models.PasswordResetRequest{}).
+		Where("user_id = ? AND id <> ? AND completed_at IS NULL AND invalidated_at IS NULL", userID, keep).
+		Update("invalidated_at", time.Now()).Error
+}
+
+// startPasswordReset records a new reset request for user and emails its OTP.
+// Only a keyed hash of the OTP is stored.
+func startPasswordReset(c *gin.Context, user models.User, initiatedBy string) error {
+	otp, err := utils.GenerateOTP()
+	if err != nil {
+		return err
+	}
+
+	ttl := config.GetenvInt("PASSWORD_RESET_OTP_TTL_MINUTES", 15)
+	now := time.Now()
+	record := models.PasswordResetRequest{
+		UserID:      user.ID,
+		InitiatedBy: initiatedBy,
+		RequestIP:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		OTPHash:     utils.HashSecret(purposeResetOTP, otp),
+		ExpiresAt:   now.Add(time.Duration(ttl) * time.Minute),
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		var stale []uint
+		activeResetRequests(tx, user.ID, now).Order("id DESC").Offset(maxActiveResetRequests).Pluck("id", &stale)
+		if len(stale) > 0 {
+			if err := tx.Model(&models.PasswordResetRequest{}).Where("id IN ?", stale).Update("invalidated_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		return queueSecretEmail(tx, c, user, mail.TemplatePasswordReset, mail.Data{"OTP": otp, "ExpiresMinutes": ttl}, time.Duration(ttl)*time.Minute)
+	})
+}
+
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+
+		return
+	}
+
+	// To prevent email enumeration, respond the same way whether or not the user exists
+	sendIfAccountExists(c, req.Email, gin.H{"message": "If the email exists, an OTP has been sent"}, func(user models.User) error {
+		return startPasswordReset(c, user, models.ResetInitiatorUser)
+	})
+}
+
+// VerifyOTP exchanges a reset OTP for a short-lived, single-use reset token.
+// Every guess counts against the user's outstanding OTPs, and an OTP is
+// invalidated after OTP_MAX_ATTEMPTS of them (0 disables the limit).
+func VerifyOTP(c *gin.Context) {
+	var req models.VerifyOTPRequest
+	if err := c.BindJSON(&req); err != nil {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP", "code": codeOTPInvalid})
+		return
+	}
+
+	now := time.Now()
+	var active []models.PasswordResetRequest
+	if err := activeResetRequests(database.DB, user.ID, now).Find(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify OTP"})
+		return
+	}
+	if len(active) == 0 {
+		var expired int64
+		database.DB.Model(&models.PasswordResetRequest{}).
+			Where("user_id = ? AND verified_at IS NULL AND invalidated_at IS NULL AND expires_at <= ?", user.ID, now).
+			Count(&expired)
+		code := codeOTPInvalid
+		if expired > 0 {
+			code = codeOTPExpired
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP", "code": code})
+		return
+	}
+
+	// count the guess against each code before comparing, so concurrent
+	// guesses cannot share one attempt
+	maxAttempts := config.GetenvInt("OTP_MAX_ATTEMPTS", 5)
+	var match *models.PasswordResetRequest
+	ids := make([]uint, 0, len(active))
+	for i := range active {
+		ids = append(ids, active[i].ID)
+		attempt := database.DB.Model(&models.PasswordResetRequest{}).
+			Where("id = ? AND verified_at IS NULL AND invalidated_at IS NULL", active[i].ID)
+		if maxAttempts > 0 {
+			attempt = attempt.Where("attempts < ?", maxAttempts)
+		}
+		res := attempt.UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify OTP"})
+			return
+		}
+		if res.RowsAffected == 1 && utils.SecretMatches(purposeResetOTP, req.OTP, active[i].OTPHash) {
+			match = &active[i]
+		}
+	}
+
+	if match == nil {
+		if maxAttempts > 0 {
+			database.DB.Model(&models.PasswordResetRequest{}).
+				Where("id IN ? AND attempts >= ? AND invalidated_at IS NULL", ids, maxAttempts).
+				Update("invalidated_at", now)
+		}
+		var remaining int64
+		activeResetRequests(database.DB, user.ID, now).Count(&remaining)
+		if remaining == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many wrong codes, request a new OTP", "code": codeOTPAttemptsExceeded})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP", "code": codeOTPInvalid})
+		return
+	}
+
+	resetToken, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify OTP"})
+		return
+	}
+	tokenHash := utils.HashSecret(purposeResetToken, resetToken)
+	tokenExpiry := now.Add(time.Duration(config.GetenvInt("PASSWORD_RESET_TOKEN_TTL_MINUTES", 10)) * time.Minute)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// claim the OTP so it can only be exchanged once
+		res := tx.Model(&models.PasswordResetRequest{}).
+			Where("id = ? AND verified_at IS NULL AND invalidated_at IS NULL", match.ID).
+			Updates(map[string]interface{}{
+				"verified_at":            now,
+				"reset_token_hash":       tokenHash,
+				"reset_token_expires_at": tokenExpiry,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		// the inbox has been proven; the other codes are no longer needed
+		return invalidateResetRequests(tx, user.ID, match.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired OTP", "code": codeOTPInvalid})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify OTP"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "OTP verified successfully",
+		"reset_token": resetToken,
+		"expires_at":  tokenExpiry.Format(time.RFC3339),
+	})
+}
+
+// ResetPassword sets a new password using the reset token from VerifyOTP.
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		return
+	}
+
+	if req.NewPassword != req.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password and confirm password do not match"})
+		return
+	}
+
+	invalidToken := func() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidResetToken.Error(), "code": codeResetTokenInvalid})
+	}
+
+	var record models.PasswordResetRequest
+	if err := database.DB.Where("reset_token_hash = ?", utils.HashSecret(purposeResetToken, req.ResetToken)).First(&record).Error; err != nil {
+		invalidToken()
+		return
+	}
+	if record.CompletedAt != nil || record.InvalidatedAt != nil || record.ResetTokenExpiresAt == nil || time.Now().After(*record.ResetTokenExpiresAt) {
+		invalidToken()
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, record.UserID).Error; err != nil {
+		invalidToken()
+		return
+	}
+	if !checkPasswordPolicy(c, req.NewPassword, user) {
+		return
+	}
+
+	newHashed, err := password.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash new password"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// claim the token so it can only be used once
+		res := tx.Model(&models.PasswordResetRequest{}).
+			Where("id = ? AND completed_at IS NULL AND invalidated_at IS NULL", record.ID).
+			Update("completed_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		// choosing a new password also lifts a lockout or an admin-forced reset
+		if err := storePassword(tx, record.UserID, newHashed, map[string]interface{}{
+			"password_reset_required": false,
+			"failed_login_attempts":   0,
+			"last_failed_login_at":    nil,
+			"locked_until":            nil,
+		}); err != nil {
+			return err
+		}
+		queuePasswordChangedAlert(tx, c, user)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidResetToken) {
+			invalidToken()
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		}
+		return
+	}
+
+	if err := invalidateResetRequests(database.DB, record.UserID, record.ID); err != nil {
+		log.Println("failed to invalidate reset requests:", err)
+	}
+	if err := revokeAllUserTokens(record.UserID); err != nil {
+		log.Println("failed to revoke tokens after password reset:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+}
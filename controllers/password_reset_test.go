@@ -0,0 +1,100 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gin-gonic/gin"
+)
+
+// verifyResetOTP exchanges otp for a reset token.
+func verifyResetOTP(t *testing.T, g *gin.Engine, email, otp string) string {
+	t.Helper()
+	w := doJSON(g, http.MethodPost, "/api/auth/verify-otp", models.VerifyOTPRequest{Email: email, OTP: otp}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected OTP to verify, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ResetToken string `json:"reset_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ResetToken == "" {
+		t.Fatalf("no reset token in response: %s", w.Body.String())
+	}
+	return resp.ResetToken
+}
+
+// resetPasswordWithOTP completes a reset with the OTP last emailed to email.
+func resetPasswordWithOTP(t *testing.T, g *gin.Engine, email, newPassword string) {
+	t.Helper()
+	otp := otpPattern.FindString(lastEmailTo(t, email).Text)
+	token := verifyResetOTP(t, g, email, otp)
+	reset := models.ResetPasswordRequest{ResetToken: token, NewPassword: newPassword, ConfirmPassword: newPassword}
+	if w := doJSON(g, http.MethodPost, "/api/auth/reset-password", reset, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected reset to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPasswordResetWithHashedOTPAndResetToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	auth := registerAndLogin(t, g, "pat@example.com", "password123")
+
+	if w := doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "pat@example.com"}, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	first := otpPattern.FindString(lastEmailTo(t, "pat@example.com").Text)
+	doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "pat@example.com"}, "")
+	second := otpPattern.FindString(lastEmailTo(t, "pat@example.com").Text)
+
+	var requests []models.PasswordResetRequest
+	database.DB.Where("user_id = ?", auth.User.ID).Find(&requests)
+	if len(requests) != 2 {
+		t.Fatalf("expected two outstanding requests, got %d", len(requests))
+	}
+	for _, r := range requests {
+		if r.OTPHash == first || r.OTPHash == second {
+			t.Fatalf("OTP stored in plaintext")
+		}
+	}
+
+	// an unknown address gets the same answer
+	w := doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: "nobody@example.com"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for unknown email, got %d", w.Code)
+	}
+
+	// either outstanding OTP works, but only once, and using one retires the other
+	token := verifyResetOTP(t, g, "pat@example.com", first)
+	for _, otp := range []string{first, second} {
+		w := doJSON(g, http.MethodPost, "/api/auth/verify-otp", models.VerifyOTPRequest{Email: "pat@example.com", OTP: otp}, "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected used or superseded OTP to be rejected, got %d", w.Code)
+		}
+	}
+
+	reset := models.ResetPasswordRequest{ResetToken: token, NewPassword: "newpass456", ConfirmPassword: "newpass456"}
+	if w := doJSON(g, http.MethodPost, "/api/auth/reset-password", reset, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected reset to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/reset-password", reset, "")
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != controllers.CodeResetTokenInvalid {
+		t.Fatalf("expected reset token to be single use, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, auth.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected tokens from before the reset to be revoked, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "pat@example.com", Password: "newpass456"}, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected login with the new password, got %d", w.Code)
+	}
+
+	var completed models.PasswordResetRequest
+	database.DB.Where("user_id = ? AND completed_at IS NOT NULL", auth.User.ID).First(&completed)
+	if completed.InitiatedBy != models.ResetInitiatorUser || completed.VerifiedAt == nil {
+		t.Fatalf("expected an audited, completed request, got %+v", completed)
+	}
+}
@@ -0,0 +1,121 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/middleware"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitByEmailSlidingWindow(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("LOGIN_BACKOFF_BASE_SECONDS", "0")
+	g := setupTestServer(t)
+	limiter := &ratelimit.Limiter{
+		Rule:  ratelimit.Rule{Name: "login", Limit: 3, Window: time.Minute, Algorithm: ratelimit.SlidingWindow},
+		Store: ratelimit.NewMemoryStore(),
+		Clock: rateClock,
+	}
+	g.POST("/api/limited/login", middleware.RateLimit(limiter, middleware.KeyByEmail), controllers.Login)
+	registerAndLogin(t, g, "rita@example.com", "password123")
+
+	login := models.LoginRequest{Email: "rita@example.com", Password: "password123"}
+	for i := 0; i < 3; i++ {
+		w := doJSON(g, http.MethodPost, "/api/limited/login", login, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(2-i) {
+			t.Fatalf("request %d: expected %d remaining, got %q", i+1, 2-i, got)
+		}
+	}
+
+	w := doJSON(g, http.MethodPost, "/api/limited/login", login, "")
+	if w.Code != http.StatusTooManyRequests || errorCode(t, w) != "rate_limited" {
+		t.Fatalf("expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Limit") != "3" {
+		t.Fatalf("missing rate limit headers: %v", w.Header())
+	}
+
+	// other addresses have their own counter
+	other := models.LoginRequest{Email: "someone@example.com", Password: "password123"}
+	if w := doJSON(g, http.MethodPost, "/api/limited/login", other, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a different email not to be limited, got %d", w.Code)
+	}
+
+	rateClock.Advance(2 * time.Minute)
+	if w := doJSON(g, http.MethodPost, "/api/limited/login", login, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected limit to reset after the window, got %d", w.Code)
+	}
+}
+
+func TestRateLimitSQLStoreSharedTokenBucket(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	rule := ratelimit.Rule{Name: "ping", Limit: 2, Window: time.Minute, Algorithm: ratelimit.TokenBucket}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	// two replicas backed by the same database share one bucket
+	replicaA := &ratelimit.Limiter{Rule: rule, Store: ratelimit.NewSQLStore(database.DB), Clock: rateClock}
+	replicaB := &ratelimit.Limiter{Rule: rule, Store: ratelimit.NewSQLStore(database.DB), Clock: rateClock}
+	g.GET("/a/ping", middleware.RateLimit(replicaA, middleware.KeyByIP), ok)
+	g.GET("/b/ping", middleware.RateLimit(replicaB, middleware.KeyByIP), ok)
+
+	if w := doJSON(g, http.MethodGet, "/a/ping", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodGet, "/b/ping", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected second request to pass, got %d", w.Code)
+	}
+	w := doJSON(g, http.MethodGet, "/a/ping", nil, "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected shared bucket to be empty, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", got)
+	}
+
+	// one token drips back every 30 seconds
+	rateClock.Advance(30 * time.Second)
+	if w := doJSON(g, http.MethodGet, "/b/ping", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected refilled token, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodGet, "/b/ping", nil, ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected bucket to be empty again, got %d", w.Code)
+	}
+}
+
+func TestRouteRateLimits(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("RATE_LIMIT_EMAIL_PER_HOUR", "2")
+	g := setupTestServer(t)
+
+	forgot := func(email string) int {
+		return doJSON(g, http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordRequest{Email: email}, "").Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := forgot("rolf@example.com"); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, code)
+		}
+	}
+	if code := forgot("rolf@example.com"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the per-email limit to apply, got %d", code)
+	}
+	if code := forgot("rhea@example.com"); code != http.StatusOK {
+		t.Fatalf("expected another address to pass, got %d", code)
+	}
+
+	// the limit runs on the test clock, stored entries included
+	rateClock.Advance(3 * time.Hour)
+	if code := forgot("rolf@example.com"); code != http.StatusOK {
+		t.Fatalf("expected the limit to reset, got %d", code)
+	}
+}
@@ -0,0 +1,73 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/middleware"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+)
+
+func TestRoleBasedAccessControl(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	g.GET("/api/reports", middleware.AuthMiddleware(), middleware.RequireRole(rbac.RoleAdmin), controllers.GetProfile)
+
+	adminAuth := loginAdmin(t, g, "root@example.com")
+	claims, err := utils.ParseToken(adminAuth.Token)
+	if err != nil {
+		t.Fatalf("parse admin token: %v", err)
+	}
+	if len(claims.Roles) != 2 || claims.Roles[0] != rbac.RoleAdmin || claims.Roles[1] != rbac.RoleUser {
+		t.Fatalf("expected admin and user roles in token, got %v", claims.Roles)
+	}
+
+	member := registerAndLogin(t, g, "member@example.com", "password123")
+	if w := doJSON(g, http.MethodGet, "/api/admin/roles", nil, member.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for regular user, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodGet, "/api/reports", nil, member.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 from RequireRole, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodGet, "/api/admin/roles", nil, adminAuth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected admin to list roles, got %d: %s", w.Code, w.Body.String())
+	}
+
+	rolesPath := fmt.Sprintf("/api/admin/users/%d/roles", member.User.ID)
+	if w := doJSON(g, http.MethodPost, rolesPath, models.AssignRoleRequest{Role: "wizard"}, adminAuth.Token); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown role to be rejected, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, rolesPath, models.AssignRoleRequest{Role: rbac.RoleAdmin}, adminAuth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected role assignment, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the new role arrives with the next refresh
+	w := doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: member.RefreshToken}, "")
+	promoted := decodeAuthData(t, w)
+	if w := doJSON(g, http.MethodGet, "/api/reports", nil, promoted.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected promoted user to pass RequireRole, got %d", w.Code)
+	}
+
+	if w := doJSON(g, http.MethodDelete, rolesPath+"/admin", nil, adminAuth.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected role removal, got %d: %s", w.Code, w.Body.String())
+	}
+	// removal revokes the access token that still carries the old role
+	if w := doJSON(g, http.MethodGet, "/api/admin/roles", nil, promoted.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected stale admin token to be revoked, got %d", w.Code)
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: promoted.RefreshToken}, "")
+	demoted := decodeAuthData(t, w)
+	if w := doJSON(g, http.MethodGet, "/api/admin/roles", nil, demoted.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 after demotion, got %d", w.Code)
+	}
+
+	selfPath := fmt.Sprintf("/api/admin/users/%d/roles/admin", adminAuth.User.ID)
+	if w := doJSON(g, http.MethodDelete, selfPath, nil, adminAuth.Token); w.Code != http.StatusConflict {
+		t.Fatalf("expected last admin to keep the role, got %d", w.Code)
+	}
+}
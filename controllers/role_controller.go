@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListRoles returns every role with the permissions it grants.
+func ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load roles"})
+		return
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = http.StatusOK
+	response.Success.Message = "Roles"
+	response.Success.Data = roles
+	c.JSON(http.StatusOK, response)
+}
+
+// userFromParam loads the user named by the :id path parameter, writing the
+// error response itself when it cannot. Soft-deleted users are only found when
+// withDeleted is set.
+func userFromParam(c *gin.Context, withDeleted bool) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return user, false
+	}
+	query := database.DB.Preload("Roles")
+	if withDeleted {
+		query = query.Unscoped()
+	}
+	if err := query.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load user"})
+		}
+		return user, false
+	}
+	return user, true
+}
+
+func respondWithUserRoles(c *gin.Context, status int, message string, userID uint) {
+	roles, err := rbac.UserRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load roles"})
+		return
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = status
+	response.Success.Message = message
+	response.Success.Data = gin.H{"user_id": userID, "roles": roles}
+	c.JSON(status, response)
+}
+
+// GetUserRoles lists the roles granted to a user.
+func GetUserRoles(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+	respondWithUserRoles(c, http.StatusOK, "User roles", user.ID)
+}
+
+// AssignRole grants a role to a user. The new role shows up in the user's
+// tokens from their next refresh or login.
+func AssignRole(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+	var input models.AssignRoleRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	if err := rbac.Assign(user.ID, input.Role); err != nil {
+		if errors.Is(err, rbac.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not assign role"})
+		return
+	}
+	respondWithUserRoles(c, http.StatusOK, "Role assigned", user.ID)
+}
+
+// RemoveRole takes a role away from a user. Access tokens issued before the
+// change are revoked so the old role claim stops working immediately; the
+// user's refresh tokens stay valid and pick up the reduced roles.
+func RemoveRole(c *gin.Context) {
+	user, ok := userFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	if err := rbac.Remove(user.ID, c.Param("role")); err != nil {
+		switch {
+		case errors.Is(err, rbac.ErrUnknownRole), errors.Is(err, rbac.ErrRoleNotGranted):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, rbac.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not remove role"})
+		}
+		return
+	}
+	if err := utils.RevokeAllTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not revoke tokens"})
+		return
+	}
+	respondWithUserRoles(c, http.StatusOK, "Role removed", user.ID)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// saveSession records that session id of userID is in use until expires,
+// creating it for the device making request c if it is new. Refresh token
+// families from before sessions existed get one on their next refresh.
+func saveSession(c *gin.Context, userID uint, id string, expires time.Time) error {
+	now := time.Now()
+	res := database.DB.Model(&models.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_seen_at": now, "expires_at": expires})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+
+	userAgent := c.Request.UserAgent()
+	return database.DB.Create(&models.Session{
+		ID:          id,
+		UserID:      userID,
+		UserAgent:   userAgent,
+		IPAddress:   c.ClientIP(),
+		DeviceLabel: deviceLabel(userAgent),
+		LastSeenAt:  now,
+		ExpiresAt:   expires,
+	}).Error
+}
+
+// deviceLabel makes a rough, human-readable name such as "Chrome on Windows"
+// from a User-Agent header.
+func deviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	find := func(names [][2]string) string {
+		for _, n := range names {
+			if strings.Contains(ua, n[0]) {
+				return n[1]
+			}
+		}
+		return ""
+	}
+
+	// order matters: most browsers also claim to be Safari or Chrome
+	browser := find([][2]string{
+		{"edg/", "Edge"}, {"opr/", "Opera"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"},
+		{"safari/", "Safari"}, {"okhttp/", "Android app"}, {"cfnetwork/", "iOS app"},
+		{"curl/", "curl"}, {"postman", "Postman"},
+	})
+	platform := find([][2]string{
+		{"iphone", "iPhone"}, {"ipad", "iPad"}, {"android", "Android"}, {"windows", "Windows"},
+		{"mac os x", "macOS"}, {"macintosh", "macOS"}, {"cros", "ChromeOS"}, {"linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
+
+// ListSessions returns the caller's active sessions, most recently used first.
+func ListSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	claims, _ := c.MustGet("claims").(*utils.Claims)
+
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load sessions"})
+		return
+	}
+
+	response := make([]models.SessionResponse, len(sessions))
+	for i, s := range sessions {
+		response[i] = models.SessionResponse{
+			ID:          s.ID,
+			DeviceLabel: s.DeviceLabel,
+			UserAgent:   s.UserAgent,
+			IPAddress:   s.IPAddress,
+			CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+			LastSeenAt:  s.LastSeenAt.Format(time.RFC3339),
+			Current:     claims != nil && claims.SessionID == s.ID,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// DeleteSession signs the caller out on one device, revoking the session's
+// access and refresh tokens.
+func DeleteSession(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err := revokeRefreshFamily(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
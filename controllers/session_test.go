@@ -0,0 +1,100 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// loginFrom logs in with the given User-Agent header.
+func loginFrom(t *testing.T, g *gin.Engine, email, password, userAgent string) models.AuthData {
+	t.Helper()
+	b, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 ok on login, got %d: %s", w.Code, w.Body.String())
+	}
+	return decodeAuthData(t, w)
+}
+
+func listSessions(t *testing.T, g *gin.Engine, token string) []models.SessionResponse {
+	t.Helper()
+	w := doJSON(g, http.MethodGet, "/api/me/sessions", nil, token)
+	var resp struct {
+		Sessions []models.SessionResponse `json:"sessions"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+		t.Fatalf("failed to list sessions, got %d: %s", w.Code, w.Body.String())
+	}
+	return resp.Sessions
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	g := setupTestServer(t)
+	doJSON(g, http.MethodPost, "/api/auth/register", models.RegisterRequest{FirstName: "Sam", LastName: "Lee", Email: "sam@example.com", Password: "password123"}, "")
+
+	laptop := loginFrom(t, g, "sam@example.com", "password123", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+	phone := loginFrom(t, g, "sam@example.com", "password123", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	claims, err := utils.ParseToken(phone.Token)
+	if err != nil || claims.SessionID == "" {
+		t.Fatalf("expected the token to carry a session id: %v", err)
+	}
+
+	labels := map[string]bool{}
+	var laptopSession string
+	for _, s := range listSessions(t, g, phone.Token) {
+		labels[s.DeviceLabel] = true
+		if s.Current != (s.ID == claims.SessionID) {
+			t.Fatalf("wrong current flag on %+v", s)
+		}
+		if s.DeviceLabel == "Chrome on Windows" {
+			laptopSession = s.ID
+		}
+	}
+	// registration signed in a third, unlabelled device
+	if len(labels) != 3 || !labels["Chrome on Windows"] || !labels["Safari on iPhone"] {
+		t.Fatalf("unexpected sessions: %v", labels)
+	}
+
+	// revoking the laptop's session from the phone signs the laptop out
+	if w := doJSON(g, http.MethodDelete, "/api/me/sessions/"+laptopSession, nil, phone.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, laptop.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked session's access token to be rejected, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: laptop.RefreshToken}, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked session's refresh token to be rejected, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodGet, "/api/me", nil, phone.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected other sessions to keep working, got %d", w.Code)
+	}
+	if len(listSessions(t, g, phone.Token)) != 2 {
+		t.Fatalf("expected the revoked session to disappear from the list")
+	}
+
+	// a refreshed token stays in its session
+	w := doJSON(g, http.MethodPost, "/api/auth/refresh", models.RefreshRequest{RefreshToken: phone.RefreshToken}, "")
+	refreshed := decodeAuthData(t, w)
+	if c, _ := utils.ParseToken(refreshed.Token); c == nil || c.SessionID != claims.SessionID {
+		t.Fatalf("expected refresh to keep the session id")
+	}
+
+	// other users' sessions cannot be revoked
+	other := registerAndLogin(t, g, "eve@example.com", "password123")
+	if w := doJSON(g, http.MethodDelete, "/api/me/sessions/"+claims.SessionID, nil, other.Token); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// issueAuthData signs a new access token for user and persists a fresh refresh
+// token in familyID. An empty familyID starts a new family and session (i.e. a
+// new login) for the device making request c.
+func issueAuthData(c *gin.Context, user models.User, familyID string) (models.AuthData, error) {
+	roles, err := rbac.UserRoles(user.ID)
+	if err != nil {
+		return models.AuthData{}, err
+	}
+
+	if familyID == "" {
+		if familyID, err = utils.RandomToken(16); err != nil {
+			return models.AuthData{}, err
+		}
+	}
+	refreshExpiry := time.Now().Add(utils.RefreshTokenTTL())
+	if err := saveSession(c, user.ID, familyID, refreshExpiry); err != nil {
+		return models.AuthData{}, err
+	}
+
+	accessToken, err := utils.GenerateToken(utils.TokenSubject{UserID: user.ID, TokenVersion: user.TokenVersion, Roles: roles, SessionID: familyID})
+	if err != nil {
+		return models.AuthData{}, err
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return models.AuthData{}, err
+	}
+	record := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: refreshHash,
+		ExpiresAt: refreshExpiry,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return models.AuthData{}, err
+	}
+
+	return models.AuthData{
+		User:                  detailedUserResponse(user),
+		Token:                 accessToken.Token,
+		TokenExpiresAt:        accessToken.ExpiresAt.Format(time.RFC3339),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiry.Format(time.RFC3339),
+	}, nil
+}
+
+// respondWithAuth writes the AuthData response shared by Register and Login.
+// Tokens are only issued when issueTokens is set; otherwise the user is returned alone.
+func respondWithAuth(c *gin.Context, status int, message string, user models.User, issueTokens bool) {
+	data := models.AuthData{User: detailedUserResponse(user)}
+	if issueTokens {
+		var err error
+		if data, err = issueAuthData(c, user, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+			return
+		}
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = status
+	response.Success.Message = message
+	response.Success.Data = data
+
+	c.JSON(status, response)
+}
+
+// detailedUserResponse is the public view of user returned by the auth endpoints.
+func detailedUserResponse(user models.User) models.DetailedUserResponse {
+	return models.DetailedUserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		CreatedAt:     user.CreatedAt.Format(time.RFC3339),
+		EmailVerified: user.IsEmailVerified(),
+	}
+}
+
+// revokeRefreshFamily revokes every refresh token descended from the same
+// login, and so ends its session.
+func revokeRefreshFamily(familyID string) error {
+	if err := utils.RevokeSession(familyID); err != nil {
+		return err
+	}
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAllUserTokens invalidates every access and refresh token the user holds.
+func revokeAllUserTokens(userID uint) error {
+	if err := utils.RevokeAllTokens(userID); err != nil {
+		return err
+	}
+	if err := utils.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair. Every
+// refresh token is single use: presenting one that was already rotated is treated
+// as theft and revokes the whole family.
+func Refresh(c *gin.Context) {
+	var input models.RefreshRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", utils.HashRefreshToken(input.RefreshToken)).First(&stored).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	if stored.RotatedAt != nil {
+		log.Printf("refresh token reuse detected for user %d, revoking family", stored.UserID)
+		if err := revokeRefreshFamily(stored.FamilyID); err != nil {
+			log.Println("failed to revoke refresh token family:", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token has been revoked"})
+		return
+	}
+	if stored.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token has been revoked"})
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token has expired"})
+		return
+	}
+	var ended int64
+	database.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NOT NULL", stored.FamilyID).Count(&ended)
+	if ended > 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token has been revoked"})
+		return
+	}
+
+	// Claim the token atomically so two concurrent refreshes cannot both succeed.
+	res := database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", stored.ID).
+		Update("rotated_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not refresh token"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		log.Printf("concurrent refresh token use for user %d, revoking family", stored.UserID)
+		if err := revokeRefreshFamily(stored.FamilyID); err != nil {
+			log.Println("failed to revoke refresh token family:", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token has been revoked"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, stored.UserID).Error; err != nil || user.IsDisabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	data, err := issueAuthData(c, user, stored.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		return
+	}
+
+	response := models.SuccessResponse{}
+	response.Success.Status = http.StatusOK
+	response.Success.Message = "Token refreshed"
+	response.Success.Data = data
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the access token used for the request and ends its session,
+// along with the refresh token family of a refresh_token in the body.
+func Logout(c *gin.Context) {
+	var input models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&input); err != nil {
+			return
+		}
+	}
+
+	claims, ok := c.MustGet("claims").(*utils.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := utils.RevokeToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+
+	if claims.SessionID != "" {
+		if err := revokeRefreshFamily(claims.SessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end session"})
+			return
+		}
+	}
+
+	if input.RefreshToken != "" {
+		var stored models.RefreshToken
+		err := database.DB.Where("token_hash = ? AND user_id = ?", utils.HashRefreshToken(input.RefreshToken), claims.UserID).First(&stored).Error
+		if err == nil {
+			if err := revokeRefreshFamily(stored.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke refresh token"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// LogoutAll revokes every access and refresh token issued to the caller.
+func LogoutAll(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*utils.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := revokeAllUserTokens(claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions"})
+}
@@ -2,15 +2,20 @@ package controllers
 
 import (
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
 	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
 	"github.com/gin-gonic/gin"
 )
 
 type UpdateUserInput struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	Locale    string `json:"locale"` // one of the locales with email templates
 }
 
 func GetProfile(c *gin.Context) {
@@ -26,12 +31,21 @@ func GetProfile(c *gin.Context) {
 		return
 	}
 
+	roles, err := rbac.UserRoles(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load roles"})
+		return
+	}
+
 	// Don't return password hash
 	c.JSON(http.StatusOK, gin.H{
-		"id":         user.ID,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"email":      user.Email,
+		"id":             user.ID,
+		"first_name":     user.FirstName,
+		"last_name":      user.LastName,
+		"email":          user.Email,
+		"email_verified": user.IsEmailVerified(),
+		"locale":         user.Locale,
+		"roles":          roles,
 	})
 }
 
@@ -55,16 +69,35 @@ func UpdateProfile(c *gin.Context) {
 	if input.LastName != "" {
 		user.LastName = input.LastName
 	}
+	if input.Locale != "" {
+		locale := strings.ToLower(input.Locale)
+		if !slices.Contains(mail.TemplatesFromEnv().Locales(), locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported locale"})
+			return
+		}
+		user.Locale = locale
+	}
 	// keep Name in sync
 	user.Name = user.FirstName + " " + user.LastName
-	database.DB.Save(&user)
+	// only the profile columns; Save would write back stale security state
+	// such as the token version or a lockout
+	err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"name":       user.Name,
+		"locale":     user.Locale,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
 
 	userResponse := models.UpdateResponse{
 		Message:       "Profile updated successfully",
 		Firstname:     user.FirstName,
 		Lastname:      user.LastName,
 		UpdateAt:      user.UpdatedAt.Format("2006-01-02 15:04:05"),
-		EmailVerified: false, // Placeholder; implement email verification logic as needed
+		EmailVerified: user.IsEmailVerified(),
 	}
 	response := models.SuccessResponse{}
 	response.Success.Status = 200
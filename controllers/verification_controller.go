@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// resendVerificationInterval stops the resend endpoint from being used to flood an inbox.
+const resendVerificationInterval = time.Minute
+
+// sendVerificationEmail emails user a fresh single-use verification link.
+func sendVerificationEmail(c *gin.Context, user models.User) error {
+	ttl := time.Duration(config.GetenvInt("EMAIL_VERIFICATION_TTL_HOURS", 24)) * time.Hour
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := createActionToken(tx, user.ID, models.PurposeEmailVerification, ttl)
+		if err != nil {
+			return err
+		}
+
+		link := config.AppURL("/verify-email?token=" + url.QueryEscape(token))
+		return queueSecretEmail(tx, c, user, mail.TemplateVerifyEmail, mail.Data{"Link": link}, ttl)
+	})
+}
+
+// VerifyEmail marks the account behind a verification token as verified.
+func VerifyEmail(c *gin.Context) {
+	var input models.VerifyEmailRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	record, err := consumeActionToken(models.PurposeEmailVerification, input.Token)
+	if err != nil {
+		if errors.Is(err, errInvalidActionToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		}
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, record.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+		return
+	}
+
+	if !user.IsEmailVerified() {
+		now := time.Now()
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Update("email_verified_at", &now).Error; err != nil {
+				return err
+			}
+			return queueEmail(tx, c, user, mail.TemplateWelcome, mail.Data{"Link": config.AppURL("/login")})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// ResendVerification sends a new verification link. The response is the same
+// whether or not the account exists, to prevent email enumeration.
+func ResendVerification(c *gin.Context) {
+	var input models.ResendVerificationRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+
+	const message = "If the account exists and is not verified, a verification email has been sent"
+
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil || user.IsEmailVerified() {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	var recent int64
+	database.DB.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, models.PurposeEmailVerification, time.Now().Add(-resendVerificationInterval)).
+		Count(&recent)
+	if recent == 0 {
+		if err := sendVerificationEmail(c, user); err != nil {
+			log.Println("failed to send verification email:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
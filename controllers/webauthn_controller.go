@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const webauthnSessionTTL = 5 * time.Minute
+
+var errWebAuthnSession = errors.New("invalid or expired webauthn session")
+
+// newWebAuthn builds the relying party from WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS.
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	rpID := config.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	var origins []string
+	for _, origin := range strings.Split(config.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		origins = []string{strings.TrimRight(config.AppURL(""), "/")}
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: appName(),
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+}
+
+// webauthnUser adapts models.User to the webauthn.User interface.
+type webauthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return webauthnUserHandle(u.user.ID)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if name := strings.TrimSpace(u.user.FirstName + " " + u.user.LastName); name != "" {
+		return name
+	}
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// webauthnUserHandle is the opaque user handle stored on the authenticator.
+func webauthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func loadWebAuthnUser(user models.User) (*webauthnUser, error) {
+	var records []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	wu := &webauthnUser{user: user}
+	for _, record := range records {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(record.Data), &credential); err != nil {
+			return nil, err
+		}
+		wu.credentials = append(wu.credentials, credential)
+	}
+	return wu, nil
+}
+
+// saveWebAuthnSession stores the ceremony state and returns the id the client
+// echoes back on finish.
+func saveWebAuthnSession(userID uint, ceremony, name string, session *webauthn.SessionData) (string, error) {
+	id, err := utils.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	record := models.WebAuthnSession{
+		ID:        id,
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Name:      name,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(webauthnSessionTTL),
+	}
+	// clear out abandoned ceremonies while we are here
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{})
+	return id, database.DB.Create(&record).Error
+}
+
+// takeWebAuthnSession loads and deletes a ceremony so its challenge is used once.
+func takeWebAuthnSession(id, ceremony string) (models.WebAuthnSession, webauthn.SessionData, error) {
+	var record models.WebAuthnSession
+	var session webauthn.SessionData
+	if err := database.DB.Where("id = ? AND ceremony = ?", id, ceremony).First(&record).Error; err != nil {
+		return record, session, errWebAuthnSession
+	}
+	res := database.DB.Where("id = ?", id).Delete(&models.WebAuthnSession{})
+	if res.Error != nil || res.RowsAffected == 0 || time.Now().After(record.ExpiresAt) {
+		return record, session, errWebAuthnSession
+	}
+	if err := json.Unmarshal([]byte(record.Data), &session); err != nil {
+		return record, session, err
+	}
+	return record, session, nil
+}
+
+// recordWebAuthnUse persists the updated sign counter after an assertion and
+// rejects authenticators that look cloned.
+func recordWebAuthnUse(credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return errors.New("authenticator sign counter went backwards; possible cloned key")
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	return database.DB.Model(&models.WebAuthnCredential{}).
+		Where("credential_id = ?", credential.ID).
+		Updates(map[string]interface{}{"data": string(data), "last_used_at": time.Now()}).Error
+}
+
+// verifyWebAuthnAssertion checks a second-factor assertion made by user.
+func verifyWebAuthnAssertion(user models.User, sessionID string, raw json.RawMessage) bool {
+	record, session, err := takeWebAuthnSession(sessionID, models.WebAuthnCeremonyMFA)
+	if err != nil || record.UserID != user.ID {
+		return false
+	}
+	w, err := newWebAuthn()
+	if err != nil {
+		log.Println("webauthn configuration error:", err)
+		return false
+	}
+	wu, err := loadWebAuthnUser(user)
+	if err != nil {
+		return false
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(raw)
+	if err != nil {
+		return false
+	}
+	credential, err := w.ValidateLogin(wu, session, parsed)
+	if err != nil {
+		return false
+	}
+	return recordWebAuthnUse(credential) == nil
+}
+
+func respondWithWebAuthnOptions(c *gin.Context, sessionID string, options interface{}) {
+	c.JSON(http.StatusOK, models.WebAuthnOptionsResponse{SessionID: sessionID, Options: options})
+}
+
+// BeginWebAuthnRegistration returns the options for navigator.credentials.create.
+func BeginWebAuthnRegistration(c *gin.Context) {
+	var input models.WebAuthnRegisterBeginRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&input); err != nil {
+			return
+		}
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !confirmIdentity(c, user, input.Password, "add a passkey") {
+		return
+	}
+	w, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webauthn is not configured"})
+		return
+	}
+	wu, err := loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load credentials"})
+		return
+	}
+
+	creation, session, err := w.BeginRegistration(wu,
+		webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+	sessionID, err := saveWebAuthnSession(user.ID, models.WebAuthnCeremonyRegistration, input.Name, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+	respondWithWebAuthnOptions(c, sessionID, creation)
+}
+
+// FinishWebAuthnRegistration verifies the attestation and stores the new credential.
+func FinishWebAuthnRegistration(c *gin.Context) {
+	var input models.WebAuthnRegisterFinishRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !confirmIdentity(c, user, input.Password, "add a passkey") {
+		return
+	}
+	record, session, err := takeWebAuthnSession(input.SessionID, models.WebAuthnCeremonyRegistration)
+	if err != nil || record.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errWebAuthnSession.Error()})
+		return
+	}
+	w, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webauthn is not configured"})
+		return
+	}
+	wu, err := loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load credentials"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+	credential, err := w.CreateCredential(wu, session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "credential verification failed"})
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store credential"})
+		return
+	}
+	name := record.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	stored := models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Data:         string(data),
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "credential is already registered"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webauthnCredentialResponse(stored))
+}
+
+func webauthnCredentialResponse(record models.WebAuthnCredential) models.WebAuthnCredentialResponse {
+	response := models.WebAuthnCredentialResponse{
+		ID:        record.ID,
+		Name:      record.Name,
+		CreatedAt: record.CreatedAt.Format(time.RFC3339),
+	}
+	if record.LastUsedAt != nil {
+		response.LastUsedAt = record.LastUsedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// ListWebAuthnCredentials lists the caller's passkeys.
+func ListWebAuthnCredentials(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var records []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load credentials"})
+		return
+	}
+	response := make([]models.WebAuthnCredentialResponse, len(records))
+	for i, record := range records {
+		response[i] = webauthnCredentialResponse(record)
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": response})
+}
+
+// DeleteWebAuthnCredential removes one of the caller's passkeys.
+func DeleteWebAuthnCredential(c *gin.Context) {
+	var input models.DeleteWebAuthnCredentialRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !confirmIdentity(c, user, input.Password, "remove a passkey") {
+		return
+	}
+
+	res := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.WebAuthnCredential{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete credential"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "credential deleted"})
+}
+
+// BeginWebAuthnLogin starts a passwordless login with a discoverable credential.
+func BeginWebAuthnLogin(c *gin.Context) {
+	w, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webauthn is not configured"})
+		return
+	}
+	assertion, session, err := w.BeginDiscoverableLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	sessionID, err := saveWebAuthnSession(0, models.WebAuthnCeremonyLogin, "", session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	respondWithWebAuthnOptions(c, sessionID, assertion)
+}
+
+// FinishWebAuthnLogin verifies a passkey assertion and logs the user in. A
+// user-verifying passkey is already multi-factor, so no MFA challenge follows,
+// and an expired password is refused here as Login would refuse it.
+func FinishWebAuthnLogin(c *gin.Context) {
+	var input models.WebAuthnFinishRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+	_, session, err := takeWebAuthnSession(input.SessionID, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errWebAuthnSession.Error()})
+		return
+	}
+	w, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webauthn is not configured"})
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	var found *webauthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		var record models.WebAuthnCredential
+		if err := database.DB.Where("credential_id = ?", rawID).First(&record).Error; err != nil {
+			return nil, err
+		}
+		if string(webauthnUserHandle(record.UserID)) != string(userHandle) {
+			return nil, errors.New("user handle does not match credential")
+		}
+		var user models.User
+		if err := database.DB.First(&user, record.UserID).Error; err != nil {
+			return nil, err
+		}
+		wu, err := loadWebAuthnUser(user)
+		found = wu
+		return wu, err
+	}
+
+	_, credential, err := w.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil || found == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if !credential.Flags.UserVerified {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user verification is required for passwordless login"})
+		return
+	}
+	if err := recordWebAuthnUse(credential); err != nil {
+		log.Println("webauthn login rejected:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	if !passwordlessLoginAllowed(c, found.user, false) {
+		return
+	}
+	respondWithAuth(c, http.StatusOK, "Login successful", found.user, true)
+}
+
+// WebAuthnMFAOptions returns assertion options for completing an MFA challenge
+// with one of the user's registered passkeys or security keys.
+func WebAuthnMFAOptions(c *gin.Context) {
+	var input models.WebAuthnMFAOptionsRequest
+	if err := c.BindJSON(&input); err != nil {
+		return
+	}
+	claims, err := utils.ParseChallengeToken(input.MFAToken, utils.PurposeMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	if revoked, err := utils.IsTokenRevoked(claims); err != nil || revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		return
+	}
+	wu, err := loadWebAuthnUser(user)
+	if err != nil || len(wu.credentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no passkeys registered"})
+		return
+	}
+	w, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webauthn is not configured"})
+		return
+	}
+	assertion, session, err := w.BeginLogin(wu)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification"})
+		return
+	}
+	sessionID, err := saveWebAuthnSession(user.ID, models.WebAuthnCeremonyMFA, "", session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification"})
+		return
+	}
+	respondWithWebAuthnOptions(c, sessionID, assertion)
+}
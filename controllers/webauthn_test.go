@@ -0,0 +1,250 @@
+package controllers_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gin-gonic/gin"
+)
+
+// softAuthenticator is an in-process WebAuthn authenticator with a P-256 key
+// and "none" attestation, standing in for a browser and security key.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id, rpID: "localhost", origin: "http://localhost:8080"}
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	return data
+}
+
+// authData builds authenticator data; attested credential data is appended
+// when attested is set.
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(0x01 | 0x04) // user present, user verified
+	if attested {
+		flags |= 0x40
+	}
+	a.signCount++
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...) // zero AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	coseKey, _ := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	return append(data, coseKey...)
+}
+
+// create answers navigator.credentials.create for challenge.
+func (a *softAuthenticator) create(challenge string, userHandle []byte) json.RawMessage {
+	a.userHandle = userHandle
+	attestation, _ := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(true),
+	})
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    b64url(a.credentialID),
+		"rawId": b64url(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64url(a.clientData("webauthn.create", challenge)),
+			"attestationObject": b64url(attestation),
+		},
+	})
+	return credential
+}
+
+// get answers navigator.credentials.get for challenge.
+func (a *softAuthenticator) get(challenge string) json.RawMessage {
+	authData := a.authData(false)
+	clientData := a.clientData("webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    b64url(a.credentialID),
+		"rawId": b64url(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64url(clientData),
+			"authenticatorData": b64url(authData),
+			"signature":         b64url(signature),
+			"userHandle":        b64url(a.userHandle),
+		},
+	})
+	return credential
+}
+
+type webauthnOptions struct {
+	SessionID string `json:"session_id"`
+	Options   struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func decodeWebAuthnOptions(t *testing.T, g *gin.Engine, path string, body interface{}, token string) webauthnOptions {
+	t.Helper()
+	w := doJSON(g, http.MethodPost, path, body, token)
+	var options webauthnOptions
+	if err := json.Unmarshal(w.Body.Bytes(), &options); err != nil || w.Code != http.StatusOK || options.SessionID == "" {
+		t.Fatalf("expected webauthn options from %s, got %d: %s", path, w.Code, w.Body.String())
+	}
+	return options
+}
+
+func TestWebAuthnPasskeyLoginAndSecondFactor(t *testing.T) {
+	g := setupTestServer(t)
+
+	data := registerAndLogin(t, g, "kim@example.com", "password123")
+	authenticator := newSoftAuthenticator(t)
+
+	// Registration ceremony
+	options := decodeWebAuthnOptions(t, g, "/api/me/webauthn/register/begin", models.WebAuthnRegisterBeginRequest{Name: "Laptop"}, data.Token)
+	userHandle, _ := base64.RawURLEncoding.DecodeString(options.Options.PublicKey.User.ID)
+	credential := authenticator.create(options.Options.PublicKey.Challenge, userHandle)
+	w := doJSON(g, http.MethodPost, "/api/me/webauthn/register/finish", models.WebAuthnFinishRequest{SessionID: options.SessionID, Credential: credential}, data.Token)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 registering passkey, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Passwordless login with the passkey
+	options = decodeWebAuthnOptions(t, g, "/api/auth/webauthn/login/begin", nil, "")
+	assertion := authenticator.get(options.Options.PublicKey.Challenge)
+	w = doJSON(g, http.MethodPost, "/api/auth/webauthn/login/finish", models.WebAuthnFinishRequest{SessionID: options.SessionID, Credential: assertion}, "")
+	if w.Code != http.StatusOK || decodeAuthData(t, w).User.Email != "kim@example.com" {
+		t.Fatalf("expected passkey login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doJSON(g, http.MethodPost, "/api/auth/webauthn/login/finish", models.WebAuthnFinishRequest{SessionID: options.SessionID, Credential: assertion}, "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected replayed assertion to be rejected, got %d", w.Code)
+	}
+
+	// The passkey is now required as a second factor after the password
+	challenge := decodeMFAChallenge(t, doJSON(g, http.MethodPost, "/api/auth/login", models.LoginRequest{Email: "kim@example.com", Password: "password123"}, ""))
+	if !slices.Contains(challenge.Methods, models.MFAMethodWebAuthn) {
+		t.Fatalf("expected webauthn in mfa methods, got %v", challenge.Methods)
+	}
+	options = decodeWebAuthnOptions(t, g, "/api/auth/mfa/webauthn/options", models.WebAuthnMFAOptionsRequest{MFAToken: challenge.MFAToken}, "")
+	w = doJSON(g, http.MethodPost, "/api/auth/mfa/verify", models.MFAVerifyRequest{
+		MFAToken:   challenge.MFAToken,
+		SessionID:  options.SessionID,
+		Credential: authenticator.get(options.Options.PublicKey.Challenge),
+	}, "")
+	if w.Code != http.StatusOK || decodeAuthData(t, w).Token == "" {
+		t.Fatalf("expected passkey to satisfy mfa, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A different key cannot stand in for the registered one
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID = authenticator.credentialID
+	impostor.userHandle = authenticator.userHandle
+	impostor.signCount = authenticator.signCount
+	options = decodeWebAuthnOptions(t, g, "/api/auth/webauthn/login/begin", nil, "")
+	w = doJSON(g, http.MethodPost, "/api/auth/webauthn/login/finish", models.WebAuthnFinishRequest{SessionID: options.SessionID, Credential: impostor.get(options.Options.PublicKey.Challenge)}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected signature from another key to be rejected, got %d", w.Code)
+	}
+
+	// A passkey does not get around a lockout
+	database.DB.Model(&models.User{}).Where("email = ?", "kim@example.com").Update("locked_until", time.Now().Add(time.Hour))
+	options = decodeWebAuthnOptions(t, g, "/api/auth/webauthn/login/begin", nil, "")
+	w = doJSON(g, http.MethodPost, "/api/auth/webauthn/login/finish", models.WebAuthnFinishRequest{SessionID: options.SessionID, Credential: authenticator.get(options.Options.PublicKey.Challenge)}, "")
+	if w.Code != http.StatusLocked || errorCode(t, w) != controllers.CodeAccountLocked {
+		t.Fatalf("expected a locked account to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebAuthnChangesNeedReauthentication(t *testing.T) {
+	t.Setenv("ACCOUNT_REAUTH_MINUTES", "0")
+	g := setupTestServer(t)
+
+	data := registerAndLogin(t, g, "lee@example.com", "password123")
+	authenticator := newSoftAuthenticator(t)
+
+	// an access token alone cannot start or finish a registration
+	w := doJSON(g, http.MethodPost, "/api/me/webauthn/register/begin", models.WebAuthnRegisterBeginRequest{Name: "Stolen"}, data.Token)
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != controllers.CodeReauthRequired {
+		t.Fatalf("expected reauthentication to be required, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(g, http.MethodPost, "/api/me/webauthn/register/begin", models.WebAuthnRegisterBeginRequest{Password: "wrong-password"}, data.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be refused, got %d", w.Code)
+	}
+	options := decodeWebAuthnOptions(t, g, "/api/me/webauthn/register/begin", models.WebAuthnRegisterBeginRequest{Password: "password123"}, data.Token)
+	userHandle, _ := base64.RawURLEncoding.DecodeString(options.Options.PublicKey.User.ID)
+	finish := models.WebAuthnRegisterFinishRequest{WebAuthnFinishRequest: models.WebAuthnFinishRequest{
+		SessionID:  options.SessionID,
+		Credential: authenticator.create(options.Options.PublicKey.Challenge, userHandle),
+	}}
+	if w := doJSON(g, http.MethodPost, "/api/me/webauthn/register/finish", finish, data.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected finishing without a password to be refused, got %d", w.Code)
+	}
+	finish.Password = "password123"
+	w = doJSON(g, http.MethodPost, "/api/me/webauthn/register/finish", finish, data.Token)
+	var credential models.WebAuthnCredentialResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &credential); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 registering passkey, got %d: %s", w.Code, w.Body.String())
+	}
+
+	path := fmt.Sprintf("/api/me/webauthn/credentials/%d", credential.ID)
+	if w := doJSON(g, http.MethodDelete, path, nil, data.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected removing a passkey to need reauthentication, got %d", w.Code)
+	}
+	if w := doJSON(g, http.MethodDelete, path, models.DeleteWebAuthnCredentialRequest{Password: "password123"}, data.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
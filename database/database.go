@@ -31,9 +31,50 @@ func Connect() {
 
 	DB = db
 
-	if err := DB.AutoMigrate(&models.User{}); err != nil {
+	if err := Migrate(DB); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
 	fmt.Println("Database Succesfully Created and Migrated")
 }
+
+// Migrate creates or updates the tables for every model the application uses.
+func Migrate(db *gorm.DB) error {
+	// Password history was first created under GORM's plural table name.
+	if db.Migrator().HasTable("password_histories") && !db.Migrator().HasTable(&models.PasswordHistory{}) {
+		if err := db.Migrator().RenameTable("password_histories", &models.PasswordHistory{}); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(
+		&models.Permission{},
+		&models.Role{},
+		&models.User{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.ActionToken{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnSession{},
+		&models.RateLimitBucket{},
+		&models.PasswordResetRequest{},
+		&models.PasswordHistory{},
+		&models.LoginCode{},
+		&models.Session{},
+		&models.OutboxMessage{},
+		&models.EmailChange{},
+	); err != nil {
+		return err
+	}
+
+	// Reset OTPs used to be stored in plaintext on the user; drop them.
+	for _, column := range []string{"reset_otp", "reset_expiry", "reset_otp_attempts"} {
+		if db.Migrator().HasColumn(&models.User{}, column) {
+			if err := db.Migrator().DropColumn(&models.User{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// FileMailer writes every message into a maildir instead of sending it, for
+// development. Open the files with any mail client, or just read them.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// NewFileMailer creates the maildir at dir if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+func (f *FileMailer) Send(ctx context.Context, msg Message) error {
+	msg, err := msg.withDefaults(f.From)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 6)
+	rand.Read(b)
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + hex.EncodeToString(b) + ".eml"
+
+	// maildir delivery: write under tmp, then move into new
+	tmp := filepath.Join(f.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, msg.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(f.Dir, "new", name))
+}
@@ -0,0 +1,84 @@
+// Package mail delivers transactional email through a pluggable Mailer.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+)
+
+// Message is one email. Text is always sent; HTML, when set, is offered as an
+// alternative. An empty From uses the mailer's configured sender.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv builds the mailer selected by MAIL_DRIVER: "resend" (the default,
+// using RESEND_API_KEY), "smtp" (SMTP_HOST, SMTP_PORT, SMTP_EMAIL,
+// SMTP_PASSWORD), "file" (a maildir under MAIL_DIR) or "memory". Mail is sent
+// from MAIL_FROM, which the drivers that really deliver require; SMTP falls
+// back to SMTP_EMAIL.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	errNoSender := fmt.Errorf("mail: MAIL_FROM is not set")
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "resend":
+		key := os.Getenv("RESEND_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("mail: RESEND_API_KEY is not set")
+		}
+		if from == "" {
+			return nil, errNoSender
+		}
+		return NewResendMailer(key, from), nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("mail: SMTP_HOST is not set")
+		}
+		if from == "" {
+			from = os.Getenv("SMTP_EMAIL")
+		}
+		if from == "" {
+			return nil, errNoSender
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     config.GetenvInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_EMAIL"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./tmp/mail"
+		}
+		return NewFileMailer(dir, localSender(from))
+	case "memory":
+		return NewMemoryMailer(localSender(from)), nil
+	default:
+		return nil, fmt.Errorf("mail: unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// localSender is from, or a placeholder for mail that never leaves this
+// machine.
+func localSender(from string) string {
+	if from != "" {
+		return from
+	}
+	return appName() + " <no-reply@localhost>"
+}
@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer records messages instead of sending them, for tests.
+type MemoryMailer struct {
+	From string
+	// Err, when set, is returned by Send and the message is not recorded.
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{From: from}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	msg, err := msg.withDefaults(m.From)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns everything sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent message sent to addr.
+func (m *MemoryMailer) Last(addr string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == addr {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Reset forgets every recorded message.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	m.messages = nil
+	m.mu.Unlock()
+}
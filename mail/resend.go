@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/resend/resend-go/v2"
+)
+
+// ResendMailer sends through the Resend API.
+type ResendMailer struct {
+	client *resend.Client
+	From   string
+}
+
+func NewResendMailer(apiKey, from string) *ResendMailer {
+	return &ResendMailer{client: resend.NewClient(apiKey), From: from}
+}
+
+func (r *ResendMailer) Send(ctx context.Context, msg Message) error {
+	msg, err := msg.withDefaults(r.From)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Emails.SendWithContext(ctx, &resend.SendEmailRequest{
+		From:    msg.From,
+		To:      []string{msg.To},
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		Html:    msg.HTML,
+	})
+	return err
+}
@@ -0,0 +1,220 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+)
+
+// Templates every locale provides.
+const (
+	TemplatePasswordReset  = "password_reset"
+	TemplateVerifyEmail    = "verify_email"
+	TemplateWelcome        = "welcome"
+	TemplateMagicLink      = "magic_link"
+	TemplateLoginCode      = "login_code"
+	TemplateSecurityAlert  = "security_alert"
+	TemplateEmailChange    = "email_change"
+	TemplateAccountDeleted = "account_deleted"
+)
+
+// DefaultLocale is used when no preferred locale has templates, and for any
+// template a locale lacks.
+const DefaultLocale = "en"
+
+//go:embed templates
+var embedded embed.FS
+
+// Data is what a template is rendered with. Render adds AppName, Locale and,
+// for the HTML layout, Subject.
+type Data map[string]interface{}
+
+// Renderer renders the emails in templates/<locale>/<name>.txt (which defines
+// "subject" and "body") and <name>.html (which defines "content" for
+// templates/layout.html).
+type Renderer struct {
+	layers []fs.FS // searched in order
+}
+
+// NewRenderer uses the embedded templates, overridden file by file by those in
+// dir when it is not empty.
+func NewRenderer(dir string) *Renderer {
+	base, _ := fs.Sub(embedded, "templates")
+	r := &Renderer{layers: []fs.FS{base}}
+	if dir != "" {
+		r.layers = append([]fs.FS{os.DirFS(dir)}, r.layers...)
+	}
+	return r
+}
+
+// TemplatesFromEnv returns a Renderer that uses MAIL_TEMPLATE_DIR for overrides.
+func TemplatesFromEnv() *Renderer {
+	return NewRenderer(os.Getenv("MAIL_TEMPLATE_DIR"))
+}
+
+func (r *Renderer) readFile(name string) (string, error) {
+	for _, layer := range r.layers {
+		b, err := fs.ReadFile(layer, name)
+		if err == nil {
+			return string(b), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fs.ErrNotExist
+}
+
+// readLocalized reads <locale>/<name>, falling back to the default locale.
+func (r *Renderer) readLocalized(locale, name string) (string, error) {
+	s, err := r.readFile(locale + "/" + name)
+	if errors.Is(err, fs.ErrNotExist) && locale != DefaultLocale {
+		s, err = r.readFile(DefaultLocale + "/" + name)
+	}
+	return s, err
+}
+
+// Locales lists the locales that have templates.
+func (r *Renderer) Locales() []string {
+	seen := map[string]bool{}
+	for _, layer := range r.layers {
+		entries, _ := fs.ReadDir(layer, ".")
+		for _, e := range entries {
+			if e.IsDir() {
+				seen[strings.ToLower(e.Name())] = true
+			}
+		}
+	}
+	locales := make([]string, 0, len(seen))
+	for l := range seen {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// MatchLocale returns the first locale with templates among preferences, each
+// of which is a language tag such as "pt-BR" or a whole Accept-Language
+// header. A regional tag also matches its base language.
+func (r *Renderer) MatchLocale(preferences ...string) string {
+	available := map[string]bool{}
+	for _, l := range r.Locales() {
+		available[l] = true
+	}
+	for _, pref := range preferences {
+		for _, tag := range parseAcceptLanguage(pref) {
+			if available[tag] {
+				return tag
+			}
+			if base, _, ok := strings.Cut(tag, "-"); ok && available[base] {
+				return base
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+// parseAcceptLanguage returns the lower-cased tags of header, most preferred
+// first.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.tag
+	}
+	return out
+}
+
+// Render builds the email name in locale. The result has no recipient.
+func (r *Renderer) Render(name, locale string, data Data) (Message, error) {
+	values := Data{}
+	for k, v := range data {
+		values[k] = v
+	}
+	values["AppName"] = appName()
+	values["Locale"] = locale
+
+	source, err := r.readLocalized(locale, name+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := texttemplate.New(name).Parse(source)
+	if err != nil {
+		return Message{}, err
+	}
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, "body", values); err != nil {
+		return Message{}, err
+	}
+	msg := Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}
+	values["Subject"] = msg.Subject
+
+	layout, err := r.readFile("layout.html")
+	if err != nil {
+		return Message{}, err
+	}
+	content, err := r.readLocalized(locale, name+".html")
+	if errors.Is(err, fs.ErrNotExist) {
+		return msg, nil // text only
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	page, err := htmltemplate.New("layout").Parse(layout)
+	if err == nil {
+		_, err = page.Parse(content)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	var html bytes.Buffer
+	if err := page.Execute(&html, values); err != nil {
+		return Message{}, err
+	}
+	msg.HTML = html.String()
+	return msg, nil
+}
+
+func appName() string {
+	if name := config.Getenv("APP_NAME"); name != "" {
+		return name
+	}
+	return "JWT Authentication"
+}
@@ -29,7 +29,18 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := utils.IsTokenRevoked(claims)
+		if err != nil || revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			return
+		}
+
+		if claims.SessionID != "" {
+			utils.TouchSession(claims.SessionID)
+		}
+
 		c.Set("userID", claims.UserID)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole allows the request when the access token carries any of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := tokenClaims(c)
+		if !ok {
+			return
+		}
+		for _, have := range claims.Roles {
+			for _, want := range roles {
+				if have == want {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+	}
+}
+
+// RequirePermission allows the request when the roles in the access token grant
+// every one of permissions. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := tokenClaims(c)
+		if !ok {
+			return
+		}
+		for _, perm := range permissions {
+			allowed, err := rbac.HasPermission(claims.Roles, perm)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not check permissions"})
+				return
+			}
+			if !allowed {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + perm})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func tokenClaims(c *gin.Context) (*utils.Claims, bool) {
+	v, _ := c.Get("claims")
+	claims, ok := v.(*utils.Claims)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+	return claims, ok
+}
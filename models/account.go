@@ -0,0 +1,11 @@
+package models
+
+// DeleteAccountRequest confirms deleting one's own account. Password may be
+// left out right after signing in.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type RestoreAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
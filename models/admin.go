@@ -0,0 +1,40 @@
+package models
+
+// AdminUserResponse is the operator view of a user returned by /api/admin/users.
+type AdminUserResponse struct {
+	ID                    uint     `json:"id"`
+	Email                 string   `json:"email"`
+	FirstName             string   `json:"first_name"`
+	LastName              string   `json:"last_name"`
+	EmailVerified         bool     `json:"email_verified"`
+	MFAEnabled            bool     `json:"mfa_enabled"`
+	Roles                 []string `json:"roles"`
+	Disabled              bool     `json:"disabled"`
+	PasswordResetRequired bool     `json:"password_reset_required"`
+	CreatedAt             string   `json:"created_at"`
+	DisabledAt            string   `json:"disabled_at,omitempty"`
+	DeletedAt             string   `json:"deleted_at,omitempty"`
+}
+
+// AdminUserList is one page of users.
+type AdminUserList struct {
+	Users   []AdminUserResponse `json:"users"`
+	Page    int                 `json:"page"`
+	PerPage int                 `json:"per_page"`
+	Total   int64               `json:"total"`
+}
+
+type AdminCreateUserRequest struct {
+	FirstName     string   `json:"first_name" binding:"required"`
+	LastName      string   `json:"last_name"`
+	Email         string   `json:"email" binding:"required,email"`
+	Password      string   `json:"password" binding:"required"`
+	Roles         []string `json:"roles"`
+	EmailVerified bool     `json:"email_verified"`
+	// RequirePasswordReset makes the user choose a new password before first login.
+	RequirePasswordReset bool `json:"require_password_reset"`
+}
+
+type AdminEmailVerifiedRequest struct {
+	Verified *bool `json:"verified" binding:"required"`
+}
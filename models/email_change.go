@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// EmailChange is a request to move an account to NewEmail. The address only
+// changes once the emailed confirmation token is used, after which the old
+// address holds a revert token for a while. Only keyed hashes of the tokens
+// are stored.
+type EmailChange struct {
+	ID               uint      `gorm:"primaryKey"`
+	UserID           uint      `gorm:"index;not null"`
+	OldEmail         string    `gorm:"not null"`
+	NewEmail         string    `gorm:"not null"`
+	ConfirmTokenHash string    `gorm:"uniqueIndex;not null"`
+	ConfirmExpiresAt time.Time `gorm:"not null"`
+	ConfirmedAt      *time.Time
+	RevertTokenHash  *string `gorm:"uniqueIndex"` // set on confirmation
+	RevertExpiresAt  *time.Time
+	RevertedAt       *time.Time
+	InvalidatedAt    *time.Time // superseded by a newer request
+	CreatedAt        time.Time
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
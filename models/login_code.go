@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LoginCode is a one-time code emailed for passwordless sign-in. Only a keyed
+// hash of the code is stored, and a user has at most one usable code.
+type LoginCode struct {
+	ID            uint      `gorm:"primaryKey"`
+	UserID        uint      `gorm:"index;not null"`
+	CodeHash      string    `gorm:"not null"`
+	Attempts      int       `gorm:"not null;default:0"` // guesses, counted before each is checked
+	ExpiresAt     time.Time `gorm:"not null"`
+	ConsumedAt    *time.Time
+	InvalidatedAt *time.Time // superseded or too many wrong guesses
+	CreatedAt     time.Time
+}
+
+type LoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type LoginWithCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	OTP   string `json:"otp" binding:"required"`
+}
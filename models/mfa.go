@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Second factors offered in an MFA challenge.
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+	MFAMethodWebAuthn     = "webauthn"
+)
+
+// RecoveryCode is a single-use backup code for users who lose their
+// authenticator. Only a keyed hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"uniqueIndex;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge is returned by Login instead of AuthData when a second factor is required.
+type MFAChallenge struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+	ExpiresAt   string   `json:"expires_at"`
+
+	// PasswordExpired asks for a new_password along with the second factor.
+	PasswordExpired bool `json:"password_expired,omitempty"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+
+	// NewPassword replaces an expired password, see MFAChallenge.PasswordExpired.
+	NewPassword string `json:"new_password,omitempty"`
+
+	// WebAuthn assertion, from POST /api/auth/mfa/webauthn/options
+	SessionID  string          `json:"session_id,omitempty"`
+	Credential json.RawMessage `json:"credential,omitempty"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPDisableRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
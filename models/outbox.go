@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Outbox message states.
+const (
+	OutboxPending = "pending" // waiting for its next attempt
+	OutboxSending = "sending" // claimed by a worker until LockedUntil
+	OutboxSent    = "sent"
+	OutboxDead    = "dead" // gave up after too many failures or once expired; the body is erased
+)
+
+// OutboxMessage is a rendered email waiting to be delivered. It is written in
+// the same transaction as the change it reports, so the email goes out if and
+// only if that change was committed.
+type OutboxMessage struct {
+	ID            uint      `gorm:"primaryKey"`
+	UserID        uint      `gorm:"index"` // the account it is about, 0 for none
+	Template      string    // the template it was rendered from, for operators
+	ToAddress     string    `gorm:"not null"`
+	Subject       string    `gorm:"not null"`
+	TextBody      string    `gorm:"type:text"` // encrypted with utils.EncryptSecret
+	HTMLBody      string    `gorm:"type:text"` // encrypted, or empty for a text-only message
+	Status        string    `gorm:"index;not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"index;not null"`
+	LockedUntil   *time.Time
+	LastError     string
+	SentAt        *time.Time
+	ExpiresAt     *time.Time `gorm:"index"` // when the code or link inside stops working
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type OutboxMessageResponse struct {
+	ID            uint   `json:"id"`
+	Template      string `json:"template"`
+	To            string `json:"to"`
+	Subject       string `json:"subject"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type OutboxMessageList struct {
+	Messages []OutboxMessageResponse `json:"messages"`
+	Page     int                     `json:"page"`
+	PerPage  int                     `json:"per_page"`
+	Total    int64                   `json:"total"`
+}
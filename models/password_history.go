@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PasswordHistory is a password hash a user has had, kept so old passwords
+// cannot be chosen again. Only the most recent PASSWORD_HISTORY_SIZE rows per
+// user are retained.
+type PasswordHistory struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"index;not null"`
+	PasswordHash string `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Who started a password reset.
+const (
+	ResetInitiatorUser  = "user"
+	ResetInitiatorAdmin = "admin"
+)
+
+// PasswordResetRequest is one "forgot password" request. The emailed OTP and
+// the reset token it is exchanged for are only stored as keyed hashes, and the
+// row is kept after completion as an audit trail.
+type PasswordResetRequest struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"index;not null"`
+	InitiatedBy string    `json:"initiated_by" gorm:"not null;default:user"`
+	RequestIP   string    `json:"request_ip"`
+	UserAgent   string    `json:"user_agent"`
+	OTPHash     string    `json:"-" gorm:"not null"`
+	Attempts    int       `json:"attempts" gorm:"not null;default:0"` // OTP guesses, counted before each is checked
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	VerifiedAt          *time.Time `json:"verified_at,omitempty"` // OTP accepted and exchanged for a reset token
+	ResetTokenHash      *string    `json:"-" gorm:"uniqueIndex"`
+	ResetTokenExpiresAt *time.Time `json:"-"`
+	CompletedAt         *time.Time `json:"completed_at,omitempty"`   // password changed with the reset token
+	InvalidatedAt       *time.Time `json:"invalidated_at,omitempty"` // superseded or too many wrong guesses
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyOTPRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	OTP   string `json:"otp" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	ResetToken      string `json:"reset_token" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=NewPassword"`
+}
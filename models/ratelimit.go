@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the shared state of one rate limit key, used when several
+// replicas must agree on the counters (RATE_LIMIT_STORE=sql).
+type RateLimitBucket struct {
+	Key       string  `gorm:"column:bucket_key;primaryKey;size:255"`
+	Value     float64 `gorm:"not null;default:0"`
+	Prev      float64 `gorm:"not null;default:0"`
+	Stamp     time.Time
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Role groups permissions and is granted to users (user_roles join table).
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+	CreatedAt   time.Time    `json:"-"`
+	UpdatedAt   time.Time    `json:"-"`
+}
+
+// Permission is a named capability such as "users:write".
+type Permission struct {
+	ID          uint   `json:"-" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
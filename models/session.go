@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. Its ID is the FamilyID of the refresh
+// tokens issued to that device and the sid claim of its access tokens.
+type Session struct {
+	ID          string `gorm:"primaryKey"`
+	UserID      uint   `gorm:"index;not null"`
+	UserAgent   string
+	IPAddress   string
+	DeviceLabel string
+	CreatedAt   time.Time
+	LastSeenAt  time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null"` // when its refresh token runs out
+	RevokedAt   *time.Time
+}
+
+type SessionResponse struct {
+	ID          string `json:"id"`
+	DeviceLabel string `json:"device_label"`
+	UserAgent   string `json:"user_agent"`
+	IPAddress   string `json:"ip_address"`
+	CreatedAt   string `json:"created_at"`
+	LastSeenAt  string `json:"last_seen_at"`
+	Current     bool   `json:"current"` // the session making the request
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// RefreshToken is a persisted, opaque refresh token. Tokens issued from the same
+// login share a FamilyID so a replayed token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	FamilyID  string    `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+	RotatedAt *time.Time // set once the token has been exchanged for a successor
+	RevokedAt *time.Time
+}
+
+// RevokedToken records an access token (by jti) that must no longer be accepted.
+// Rows can be discarded once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+}
+
+// Purposes of ActionToken.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeAccountUnlock     = "account_unlock"
+	PurposeMagicLink         = "magic_link"
+	PurposeAccountRestore    = "account_restore"
+)
+
+// ActionToken is a single-use secret emailed to a user, such as the token in an
+// email verification link. Only a keyed hash of the secret is stored.
+type ActionToken struct {
+	ID         uint      `gorm:"primaryKey"`
+	UserID     uint      `gorm:"index;not null"`
+	Purpose    string    `gorm:"index;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+	// BindingHash, when set, is a keyed hash of a second secret held by the
+	// device that asked for the token; the token is only accepted alongside it.
+	BindingHash string
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	// Optional: also revoke the refresh token (and its family) held by this client.
+	RefreshToken string `json:"refresh_token"`
+}
@@ -13,9 +13,47 @@ type User struct {
 	Name         string `json:"name"`
 	Email        string `json:"email" gorm:"uniqueIndex;not null"`
 	PasswordHash string `json:"-" gorm:"not null"`
+	TokenVersion uint   `json:"-" gorm:"not null;default:0"` // bumped to revoke every outstanding access token
 
-	ResetOTP    string    `json:"-"` // OTP for password reset
-	ResetExpiry time.Time `json:"-"` // Expiry time for the OTP
+	PasswordChangedAt *time.Time `json:"-"` // nil for accounts created before it was recorded
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Locale          string     `json:"locale,omitempty"` // preferred language for email, e.g. "fr"
+
+	TOTPSecret    string     `json:"-"` // encrypted; set during enrollment, before confirmation
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPLastStep  int64      `json:"-"` // last accepted time step, to stop code replay
+
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles;"`
+
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required" gorm:"not null;default:false"`
+
+	FailedLoginAttempts int        `json:"-" gorm:"not null;default:0"` // consecutive wrong passwords
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+
+	PurgeAfter *time.Time `json:"-"` // set when the owner deletes the account; it is erased after this
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address.
+func (u User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsDisabled reports whether an administrator has disabled the account.
+func (u User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// IsLocked reports whether too many failed logins have locked the account at t.
+func (u User) IsLocked(t time.Time) bool {
+	return u.LockedUntil != nil && t.Before(*u.LockedUntil)
+}
+
+// HasTOTP reports whether the user has confirmed a TOTP authenticator.
+func (u User) HasTOTP() bool {
+	return u.TOTPEnabledAt != nil
 }
 
 type RegisterRequest struct {
@@ -24,17 +62,43 @@ type RegisterRequest struct {
 	LastName  string `json:"last_name"`
 	Name      string `json:"name"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
+	Password  string `json:"password" binding:"required"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// Replaces the password when it has expired (PASSWORD_MAX_AGE_DAYS).
+	NewPassword string `json:"new_password"`
 }
 
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
-	NewPassword     string `json:"new_password" binding:"required,min=6"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	// Bind the link to this device: the response carries a device_token that
+	// must accompany the link's token.
+	BindDevice bool `json:"bind_device"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token       string `json:"token" binding:"required"`
+	DeviceToken string `json:"device_token"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 type UpdateResponse struct {
@@ -66,8 +130,11 @@ type DetailedUserResponse struct {
 }
 
 type AuthData struct {
-	User  DetailedUserResponse `json:"user"`
-	Token string               `json:"token"`
+	User                  DetailedUserResponse `json:"user"`
+	Token                 string               `json:"token,omitempty"`
+	TokenExpiresAt        string               `json:"token_expires_at,omitempty"`
+	RefreshToken          string               `json:"refresh_token,omitempty"`
+	RefreshTokenExpiresAt string               `json:"refresh_token_expires_at,omitempty"`
 }
 
 type SuccessResponse struct {
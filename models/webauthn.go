@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Ceremonies a WebAuthnSession can belong to.
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+	WebAuthnCeremonyMFA          = "mfa"
+)
+
+// WebAuthnCredential is a passkey or security key registered to a user. Data
+// holds the library's credential record (public key, sign counter, flags) as JSON.
+type WebAuthnCredential struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"index;not null"`
+	CredentialID []byte `gorm:"uniqueIndex;not null"`
+	Name         string
+	Data         string `gorm:"type:text;not null"`
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+// WebAuthnSession holds the challenge of a ceremony between its begin and
+// finish requests. Rows are deleted when the ceremony finishes.
+type WebAuthnSession struct {
+	ID        string `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"` // zero for discoverable (passwordless) logins
+	Ceremony  string `gorm:"not null"`
+	Name      string // credential name chosen at registration
+	Data      string `gorm:"type:text;not null"`
+	ExpiresAt time.Time
+}
+
+// WebAuthnRegisterBeginRequest starts registering a passkey. Password is needed
+// unless the session signed in within ACCOUNT_REAUTH_MINUTES, as it is for
+// finishing the registration and for deleting a passkey.
+type WebAuthnRegisterBeginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type WebAuthnRegisterFinishRequest struct {
+	WebAuthnFinishRequest
+	Password string `json:"password"`
+}
+
+type DeleteWebAuthnCredentialRequest struct {
+	Password string `json:"password"`
+}
+
+// WebAuthnFinishRequest carries the PublicKeyCredential produced by the browser
+// (navigator.credentials.create/get), serialised as JSON.
+type WebAuthnFinishRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnMFAOptionsRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// WebAuthnOptionsResponse wraps the options to pass to the browser API.
+type WebAuthnOptionsResponse struct {
+	SessionID string      `json:"session_id"`
+	Options   interface{} `json:"options"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,328 @@
+// Package outbox delivers email written to the outbox_messages table. Handlers
+// call Enqueue inside the transaction that makes the change an email reports,
+// and a Worker sends what was committed, retrying failures with exponential
+// backoff until a message is sent or declared dead. Bodies are stored
+// encrypted and erased once they can no longer be delivered usefully.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/mail"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"github.com/gbadegesintestimony/jwt-authentication/utils"
+	"gorm.io/gorm"
+)
+
+// ErrNotFailing is returned by Requeue for a message that is not waiting to
+// retry a failed delivery.
+var ErrNotFailing = errors.New("outbox: message is not waiting for a retry")
+
+// errExpired is recorded on a message whose code or link ran out before it
+// could be delivered.
+var errExpired = errors.New("expired before delivery")
+
+// erased clears the bodies of a message that will not be sent again.
+var erased = map[string]interface{}{"text_body": "", "html_body": ""}
+
+// Enqueue stores msg for delivery using tx, with its bodies encrypted. userID
+// is the account the message is about, so it can be erased with it, and
+// template names what msg was rendered from. A message that is still unsent at
+// expiresAt is given up on; the zero time means it never expires.
+func Enqueue(tx *gorm.DB, userID uint, template string, msg mail.Message, expiresAt time.Time) error {
+	text, err := utils.EncryptSecret(msg.Text)
+	if err != nil {
+		return err
+	}
+	html := ""
+	if msg.HTML != "" {
+		if html, err = utils.EncryptSecret(msg.HTML); err != nil {
+			return err
+		}
+	}
+	record := models.OutboxMessage{
+		UserID:        userID,
+		Template:      template,
+		ToAddress:     msg.To,
+		Subject:       msg.Subject,
+		TextBody:      text,
+		HTMLBody:      html,
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if !expiresAt.IsZero() {
+		record.ExpiresAt = &expiresAt
+	}
+	return tx.Create(&record).Error
+}
+
+// Requeue gives a message that failed and is waiting to retry a fresh set of
+// attempts, starting now. Dead messages cannot be requeued: their bodies are
+// erased when they are given up on.
+func Requeue(db *gorm.DB, id uint) error {
+	var msg models.OutboxMessage
+	if err := db.First(&msg, id).Error; err != nil {
+		return err
+	}
+	res := db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ? AND last_error <> ''", id, models.OutboxPending).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"locked_until":    nil,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFailing
+	}
+	return nil
+}
+
+// Worker delivers due messages with a pool of goroutines. Several replicas may
+// run workers against the same database; each message is claimed by one of
+// them at a time.
+type Worker struct {
+	DB     *gorm.DB
+	Mailer mail.Mailer
+
+	Workers      int           // concurrent deliveries
+	MaxAttempts  int           // failures before a message is dead
+	BaseDelay    time.Duration // wait after the first failure, doubled after each one
+	MaxDelay     time.Duration // longest wait between attempts
+	PollInterval time.Duration // how often an idle worker looks for work
+	Lease        time.Duration // how long a claim lasts before another worker may retry
+	Retention    time.Duration // how long sent messages are kept
+}
+
+// NewWorker returns a Worker configured by OUTBOX_WORKERS,
+// OUTBOX_MAX_ATTEMPTS, OUTBOX_RETRY_BASE_SECONDS, OUTBOX_RETRY_MAX_SECONDS,
+// OUTBOX_POLL_SECONDS and OUTBOX_RETENTION_DAYS.
+func NewWorker(db *gorm.DB, mailer mail.Mailer) *Worker {
+	return &Worker{
+		DB:           db,
+		Mailer:       mailer,
+		Workers:      config.GetenvInt("OUTBOX_WORKERS", 4),
+		MaxAttempts:  config.GetenvInt("OUTBOX_MAX_ATTEMPTS", 8),
+		BaseDelay:    time.Duration(config.GetenvInt("OUTBOX_RETRY_BASE_SECONDS", 30)) * time.Second,
+		MaxDelay:     time.Duration(config.GetenvInt("OUTBOX_RETRY_MAX_SECONDS", 3600)) * time.Second,
+		PollInterval: time.Duration(config.GetenvInt("OUTBOX_POLL_SECONDS", 2)) * time.Second,
+		Lease:        time.Minute,
+		Retention:    time.Duration(config.GetenvInt("OUTBOX_RETENTION_DAYS", 7)) * 24 * time.Hour,
+	}
+}
+
+// Run delivers messages until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	workers := max(w.Workers, 1)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+	for {
+		w.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-cleanup.C:
+		}
+	}
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivered, err := w.deliverNext(ctx)
+		if err != nil {
+			log.Println("outbox:", err)
+		}
+		if delivered && err == nil {
+			continue // there may be more waiting
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// Drain attempts every message that is due, one at a time, and returns how
+// many it attempted.
+func (w *Worker) Drain(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		attempted, err := w.deliverNext(ctx)
+		if err != nil || !attempted {
+			return n, err
+		}
+		n++
+	}
+}
+
+// deliverNext claims one due message and tries to send it. It reports whether
+// there was a message to try.
+func (w *Worker) deliverNext(ctx context.Context) (bool, error) {
+	msg, ok, err := w.claim(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	db := w.DB.WithContext(context.WithoutCancel(ctx))
+	now := time.Now()
+	if msg.ExpiresAt != nil && now.After(*msg.ExpiresAt) {
+		return true, w.giveUp(db, msg, errExpired)
+	}
+	body, err := decryptBody(msg)
+	if err != nil {
+		return true, w.giveUp(db, msg, err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, w.Lease/2)
+	sendErr := w.Mailer.Send(sendCtx, body)
+	cancel()
+
+	now = time.Now()
+	if sendErr == nil {
+		// the bodies hold codes and links that should not outlive delivery
+		return true, db.Model(&msg).Updates(map[string]interface{}{
+			"status":       models.OutboxSent,
+			"sent_at":      now,
+			"locked_until": nil,
+			"last_error":   "",
+			"text_body":    "",
+			"html_body":    "",
+		}).Error
+	}
+
+	if msg.Attempts >= w.MaxAttempts {
+		log.Printf("outbox: giving up on message %d to %s after %d attempts: %v", msg.ID, msg.ToAddress, msg.Attempts, sendErr)
+		return true, w.giveUp(db, msg, sendErr)
+	}
+	return true, db.Model(&msg).Updates(map[string]interface{}{
+		"status":          models.OutboxPending,
+		"next_attempt_at": now.Add(w.backoff(msg.Attempts)),
+		"locked_until":    nil,
+		"last_error":      sendErr.Error(),
+	}).Error
+}
+
+// giveUp marks msg dead because of cause and erases its bodies.
+func (w *Worker) giveUp(db *gorm.DB, msg models.OutboxMessage, cause error) error {
+	update := map[string]interface{}{
+		"status":       models.OutboxDead,
+		"locked_until": nil,
+		"last_error":   cause.Error(),
+	}
+	for column, value := range erased {
+		update[column] = value
+	}
+	return db.Model(&msg).Updates(update).Error
+}
+
+// decryptBody turns the stored message back into one the Mailer can send.
+func decryptBody(msg models.OutboxMessage) (mail.Message, error) {
+	text, err := utils.DecryptSecret(msg.TextBody)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	html := ""
+	if msg.HTMLBody != "" {
+		if html, err = utils.DecryptSecret(msg.HTMLBody); err != nil {
+			return mail.Message{}, err
+		}
+	}
+	return mail.Message{To: msg.ToAddress, Subject: msg.Subject, Text: text, HTML: html}, nil
+}
+
+// claim takes the oldest due message, or one whose claim has lapsed, and
+// counts the attempt.
+func (w *Worker) claim(ctx context.Context) (models.OutboxMessage, bool, error) {
+	db := w.DB.WithContext(ctx)
+	for {
+		now := time.Now()
+		due := db.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+			models.OutboxPending, now, models.OutboxSending, now)
+
+		var msg models.OutboxMessage
+		err := due.Order("next_attempt_at, id").First(&msg).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return msg, false, nil
+		}
+		if err != nil {
+			return msg, false, err
+		}
+
+		lease := now.Add(w.Lease)
+		res := db.Model(&models.OutboxMessage{}).
+			Where("id = ? AND status = ? AND attempts = ?", msg.ID, msg.Status, msg.Attempts).
+			Updates(map[string]interface{}{
+				"status":       models.OutboxSending,
+				"locked_until": lease,
+				"attempts":     msg.Attempts + 1,
+			})
+		if res.Error != nil {
+			return msg, false, res.Error
+		}
+		if res.RowsAffected == 1 {
+			msg.Status = models.OutboxSending
+			msg.LockedUntil = &lease
+			msg.Attempts++
+			return msg, true, nil
+		}
+		// another worker got there first
+	}
+}
+
+// backoff is the wait after the given number of failed attempts: BaseDelay
+// doubled per earlier failure, capped at MaxDelay, with up to a quarter taken
+// off at random so retries from a burst spread out.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.BaseDelay
+	for i := 1; i < attempts && d < w.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, w.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return d - rand.N(d/4+1)
+}
+
+// cleanup gives up on waiting messages whose code or link has expired, and
+// deletes sent messages older than Retention.
+func (w *Worker) cleanup(ctx context.Context) {
+	db := w.DB.WithContext(ctx)
+	now := time.Now()
+	update := map[string]interface{}{"status": models.OutboxDead, "last_error": errExpired.Error()}
+	for column, value := range erased {
+		update[column] = value
+	}
+	if err := db.Model(&models.OutboxMessage{}).Where("status = ? AND expires_at < ?", models.OutboxPending, now).
+		Updates(update).Error; err != nil && ctx.Err() == nil {
+		log.Println("outbox: cleanup failed:", err)
+	}
+
+	if w.Retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-w.Retention)
+	if err := db.Where("status = ? AND sent_at < ?", models.OutboxSent, cutoff).
+		Delete(&models.OutboxMessage{}).Error; err != nil && ctx.Err() == nil {
+		log.Println("outbox: cleanup failed:", err)
+	}
+}
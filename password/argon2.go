@@ -0,0 +1,64 @@
+package password
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idHasher hashes with argon2id (RFC 9106). Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  int
+	KeyLength   uint32
+}
+
+// argon2idFromEnv follows the RFC 9106 second recommended option by default:
+// 64 MiB, 3 passes.
+func argon2idFromEnv() Argon2idHasher {
+	return Argon2idHasher{
+		Memory:      uint32(costFromEnv("ARGON2_MEMORY_KIB", 64*1024)),
+		Iterations:  uint32(costFromEnv("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(costFromEnv("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(h.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parsePHC(encoded)
+	if err != nil || p.id != Argon2id || p.version != argon2.Version {
+		return false, ErrUnknownFormat
+	}
+	m, t, par := p.params["m"], p.params["t"], p.params["p"]
+	if m <= 0 || t <= 0 || par <= 0 || par > 255 {
+		return false, ErrUnknownFormat
+	}
+	key := argon2.IDKey([]byte(password), p.salt, uint32(t), uint32(m), uint8(par), uint32(len(p.hash)))
+	return subtle.ConstantTimeCompare(key, p.hash) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := parsePHC(encoded)
+	if err != nil || p.version != argon2.Version {
+		return true
+	}
+	return uint32(p.params["m"]) < h.Memory ||
+		uint32(p.params["t"]) < h.Iterations ||
+		p.params["p"] < int(h.Parallelism) ||
+		uint32(len(p.hash)) < h.KeyLength ||
+		len(p.salt) < h.SaltLength
+}
@@ -0,0 +1,39 @@
+package password
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxBytes is the longest password bcrypt hashes; longer ones are refused
+// with bcrypt.ErrPasswordTooLong.
+const bcryptMaxBytes = 72
+
+// BcryptHasher hashes with bcrypt. Its hashes keep bcrypt's own $2a$ format,
+// which is what the application stored before the other algorithms existed.
+type BcryptHasher struct {
+	Cost int
+}
+
+func bcryptFromEnv() BcryptHasher {
+	return BcryptHasher{Cost: costFromEnv("BCRYPT_COST", 12)}
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hashed), err
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
@@ -0,0 +1,279 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BreachCorpus answers whether a password appears in a list of breached
+// passwords, such as the Pwned Passwords (HIBP) SHA-1 corpus.
+type BreachCorpus interface {
+	Contains(password string) (bool, error)
+}
+
+// OpenBreachCorpus opens the corpus at path: a directory in the HIBP "range"
+// layout (one file per five-hex-digit SHA-1 prefix, lines of SUFFIX:COUNT), or
+// a Bloom filter file written by cmd/breachfilter. Range entries seen fewer
+// than minCount times are ignored.
+func OpenBreachCorpus(path string, minCount int) (BreachCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return RangeDirectory{Dir: path, MinCount: minCount}, nil
+	}
+	return loadBloomFilter(path, info.ModTime())
+}
+
+// RangeDirectory is a local copy of the HIBP range API: file ABCDE (or
+// ABCDE.txt) lists the remaining 35 hex digits of every breached SHA-1 hash
+// starting with ABCDE, each followed by a colon and a count.
+type RangeDirectory struct {
+	Dir      string
+	MinCount int
+}
+
+// Contains looks password up in the range file for its hash prefix.
+func (d RangeDirectory) Contains(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(d.Dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(d.Dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	found := false
+	err = scanRangeFile(f, d.MinCount, func(lineSuffix string) bool {
+		found = strings.EqualFold(lineSuffix, suffix)
+		return !found
+	})
+	return found, err
+}
+
+// scanRangeFile calls fn with the hash suffix of every entry in r seen at
+// least minCount times, until fn returns false.
+func scanRangeFile(r io.Reader, minCount int, fn func(suffix string) bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		suffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix == "" {
+			continue
+		}
+		if ok && minCount > 1 {
+			if n, err := strconv.Atoi(count); err == nil && n < minCount {
+				continue
+			}
+		}
+		if !fn(suffix) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadCorpus calls fn with the SHA-1 digest of every password in the corpus at
+// path seen at least minCount times. path is either a range directory or a
+// single file of full HASH:COUNT lines, as in the downloadable
+// pwned-passwords-sha1 files.
+func ReadCorpus(path string, minCount int, fn func(digest [sha1.Size]byte)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return readCorpusFile(path, "", minCount, fn)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		prefix := strings.TrimSuffix(entry.Name(), ".txt")
+		if entry.IsDir() || len(prefix) != 5 {
+			continue
+		}
+		if _, err := hex.DecodeString(prefix + "0"); err != nil {
+			continue
+		}
+		if err := readCorpusFile(filepath.Join(path, entry.Name()), prefix, minCount, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCorpusFile(path, prefix string, minCount int, fn func(digest [sha1.Size]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var parseErr error
+	err = scanRangeFile(f, minCount, func(suffix string) bool {
+		var digest [sha1.Size]byte
+		if n, err := hex.Decode(digest[:], []byte(prefix+suffix)); err != nil || n != sha1.Size {
+			parseErr = fmt.Errorf("%s: malformed hash %q", path, prefix+suffix)
+			return false
+		}
+		fn(digest)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return parseErr
+}
+
+const bloomMagic = "PWBLOOM1"
+
+// BloomFilter is a compact, probabilistic form of a breach corpus. It never
+// misses a breached password, but reports a small fraction of other passwords
+// as breached too.
+type BloomFilter struct {
+	k    uint32 // hash functions
+	m    uint64 // bits
+	bits []uint64
+}
+
+// NewBloomFilter sizes a filter for n passwords with the given false positive
+// rate.
+func NewBloomFilter(n uint64, falsePositiveRate float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{k: k, m: m, bits: make([]uint64, m/64)}
+}
+
+// Add records a SHA-1 digest in the filter.
+func (f *BloomFilter) Add(digest [sha1.Size]byte) {
+	f.positions(digest, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// Contains reports whether password is, probably, in the filter.
+func (f *BloomFilter) Contains(password string) (bool, error) {
+	found := true
+	f.positions(sha1.Sum([]byte(password)), func(bit uint64) bool {
+		found = f.bits[bit/64]&(1<<(bit%64)) != 0
+		return found
+	})
+	return found, nil
+}
+
+// positions derives the filter's k bit positions for digest by double
+// hashing; the digest is already uniformly distributed.
+func (f *BloomFilter) positions(digest [sha1.Size]byte, fn func(bit uint64) bool) {
+	h1 := binary.LittleEndian.Uint64(digest[0:8])
+	h2 := binary.LittleEndian.Uint64(digest[8:16]) | 1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
+
+// WriteTo writes the filter in the format OpenBreachCorpus reads.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, len(bloomMagic)+4+8)
+	copy(header, bloomMagic)
+	binary.LittleEndian.PutUint32(header[8:], f.k)
+	binary.LittleEndian.PutUint64(header[12:], f.m)
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+	word := make([]byte, 8)
+	for _, bits := range f.bits {
+		binary.LittleEndian.PutUint64(word, bits)
+		if _, err := bw.Write(word); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(header) + 8*len(f.bits)), bw.Flush()
+}
+
+// ReadBloomFilter reads a filter written by WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(bloomMagic)+4+8)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:8]) != bloomMagic {
+		return nil, errors.New("password: not a breached password filter")
+	}
+	f := &BloomFilter{
+		k: binary.LittleEndian.Uint32(header[8:]),
+		m: binary.LittleEndian.Uint64(header[12:]),
+	}
+	if f.k == 0 || f.m == 0 || f.m%64 != 0 {
+		return nil, errors.New("password: corrupt breached password filter")
+	}
+	f.bits = make([]uint64, f.m/64)
+	word := make([]byte, 8)
+	for i := range f.bits {
+		if _, err := io.ReadFull(br, word); err != nil {
+			return nil, errors.New("password: truncated breached password filter")
+		}
+		f.bits[i] = binary.LittleEndian.Uint64(word)
+	}
+	return f, nil
+}
+
+var bloomCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	filter  *BloomFilter
+}
+
+// loadBloomFilter reads the filter at path, reusing it until the file changes.
+func loadBloomFilter(path string, modTime time.Time) (*BloomFilter, error) {
+	bloomCache.Lock()
+	defer bloomCache.Unlock()
+	if bloomCache.path == path && bloomCache.modTime.Equal(modTime) {
+		return bloomCache.filter, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	filter, err := ReadBloomFilter(file)
+	if err != nil {
+		return nil, err
+	}
+
+	bloomCache.path, bloomCache.modTime, bloomCache.filter = path, modTime, filter
+	return filter, nil
+}
@@ -0,0 +1,179 @@
+// Package password hashes and verifies user passwords. Hashes are stored as
+// self-describing PHC strings ($argon2id$..., $scrypt$...) or bcrypt's own
+// $2a$ format, so the algorithm and its cost can change without invalidating
+// existing hashes: Verify understands every supported format and NeedsRehash
+// tells the caller when a stored hash is weaker than the current policy.
+package password
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+)
+
+// Supported algorithms, as named by PASSWORD_HASH_ALGORITHM.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+	Scrypt   = "scrypt"
+)
+
+var (
+	ErrUnknownFormat = errors.New("password: unrecognised hash format")
+	ErrUnknownHasher = errors.New("password: unknown hash algorithm")
+)
+
+// Hasher produces and checks hashes for one algorithm.
+type Hasher interface {
+	// Hash returns the encoded hash of password with a fresh random salt.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, which must be in this
+	// hasher's format. The parameters are taken from encoded, not the hasher.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded (in this hasher's format) uses weaker
+	// parameters than the hasher.
+	NeedsRehash(encoded string) bool
+}
+
+// Current returns the hasher selected by PASSWORD_HASH_ALGORITHM (argon2id by
+// default) with costs from the environment. Servers call it at startup, so an
+// unknown algorithm stops them there instead of failing every login.
+func Current() (Hasher, error) {
+	return forAlgorithm(currentAlgorithm())
+}
+
+func currentAlgorithm() string {
+	if name := config.Getenv("PASSWORD_HASH_ALGORITHM"); name != "" {
+		return name
+	}
+	return Argon2id
+}
+
+func forAlgorithm(name string) (Hasher, error) {
+	switch name {
+	case Argon2id:
+		return argon2idFromEnv(), nil
+	case Bcrypt:
+		return bcryptFromEnv(), nil
+	case Scrypt:
+		return scryptFromEnv(), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownHasher, name)
+}
+
+// algorithmOf names the algorithm that produced encoded.
+func algorithmOf(encoded string) (string, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id, nil
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return Scrypt, nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Hash hashes password with the current hasher.
+func Hash(password string) (string, error) {
+	h, err := Current()
+	if err != nil {
+		return "", err
+	}
+	return h.Hash(password)
+}
+
+// Verify reports whether password matches encoded, whatever supported
+// algorithm produced it.
+func Verify(password, encoded string) (bool, error) {
+	alg, err := algorithmOf(encoded)
+	if err != nil {
+		return false, err
+	}
+	h, err := forAlgorithm(alg)
+	if err != nil {
+		return false, err
+	}
+	return h.Verify(password, encoded)
+}
+
+// NeedsRehash reports whether encoded should be replaced by a fresh hash: it
+// was made by a different algorithm than the current one, or with weaker costs.
+func NeedsRehash(encoded string) bool {
+	alg, err := algorithmOf(encoded)
+	if err != nil || alg != currentAlgorithm() {
+		return true
+	}
+	h, err := forAlgorithm(alg)
+	if err != nil {
+		return false
+	}
+	return h.NeedsRehash(encoded)
+}
+
+var b64 = base64.RawStdEncoding
+
+func newSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+// phc is a parsed "$id$v=19$a=1,b=2$salt$hash" string. The version field is
+// optional.
+type phc struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(encoded string) (phc, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return phc{}, ErrUnknownFormat
+	}
+	p := phc{id: parts[1], params: make(map[string]int)}
+	rest := parts[2:]
+	if strings.HasPrefix(rest[0], "v=") {
+		v, err := strconv.Atoi(strings.TrimPrefix(rest[0], "v="))
+		if err != nil {
+			return phc{}, ErrUnknownFormat
+		}
+		p.version = v
+		rest = rest[1:]
+	}
+	if len(rest) != 3 {
+		return phc{}, ErrUnknownFormat
+	}
+	for _, kv := range strings.Split(rest[0], ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		n, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			return phc{}, ErrUnknownFormat
+		}
+		p.params[k] = n
+	}
+	var err error
+	if p.salt, err = b64.DecodeString(rest[1]); err != nil {
+		return phc{}, ErrUnknownFormat
+	}
+	if p.hash, err = b64.DecodeString(rest[2]); err != nil {
+		return phc{}, ErrUnknownFormat
+	}
+	return p, nil
+}
+
+// costFromEnv is config.GetenvInt for a cost parameter, which must be positive.
+func costFromEnv(key string, def int) int {
+	if v := config.GetenvInt(key, def); v > 0 {
+		return v
+	}
+	return def
+}
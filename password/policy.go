@@ -0,0 +1,179 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+)
+
+// Rule names reported in a Violation.
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxLength     = "max_length"
+	RuleStrength      = "strength"
+	RuleContainsEmail = "contains_email"
+	RuleContainsName  = "contains_name"
+	RuleBlocklisted   = "blocklisted"
+	RuleBreached      = "breached"
+	RuleReused        = "reused" // reported by callers that keep a password history
+)
+
+// Violation is one policy rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Account is what the policy knows about the password's owner, so it can
+// reject passwords built from their own details.
+type Account struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Policy is the set of rules new passwords must satisfy.
+type Policy struct {
+	MinLength int // in characters
+	MaxLength int
+	MaxBytes  int // set when the hasher cannot take longer input, 0 otherwise
+	MinScore  int // minimum Strength, 0 to 4
+	Blocklist map[string]bool
+	Breaches  BreachCorpus // optional
+}
+
+// CurrentPolicy builds the policy from PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH,
+// PASSWORD_MIN_SCORE, the optional PASSWORD_BLOCKLIST_FILE (one password per
+// line, compared case-insensitively) and the optional PASSWORD_BREACH_CORPUS
+// (see OpenBreachCorpus; range entries seen fewer than
+// PASSWORD_BREACH_MIN_COUNT times are ignored). With bcrypt as the current
+// algorithm, passwords are also capped at the 72 bytes bcrypt accepts.
+func CurrentPolicy() (Policy, error) {
+	p := Policy{
+		MinLength: config.GetenvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength: config.GetenvInt("PASSWORD_MAX_LENGTH", 128),
+		MinScore:  config.GetenvInt("PASSWORD_MIN_SCORE", 2),
+	}
+	if currentAlgorithm() == Bcrypt {
+		p.MaxBytes = bcryptMaxBytes
+	}
+
+	if path := config.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		list, err := loadBlocklist(path)
+		if err != nil {
+			return Policy{}, err
+		}
+		p.Blocklist = list
+	}
+	if path := config.Getenv("PASSWORD_BREACH_CORPUS"); path != "" {
+		corpus, err := OpenBreachCorpus(path, config.GetenvInt("PASSWORD_BREACH_MIN_COUNT", 1))
+		if err != nil {
+			return Policy{}, err
+		}
+		p.Breaches = corpus
+	}
+	return p, nil
+}
+
+// Check returns every rule password breaks for account, or nil if it is
+// acceptable. The error is only set when the breach corpus cannot be read.
+func (p Policy) Check(password string, account Account) ([]Violation, error) {
+	var violations []Violation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(RuleMinLength, "must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		// nothing else is worth the work on an oversized password
+		add(RuleMaxLength, "must be at most %d characters", p.MaxLength)
+		return violations, nil
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add(RuleMaxLength, "must be at most %d bytes", p.MaxBytes)
+		return violations, nil
+	}
+
+	lower := strings.ToLower(password)
+	email := strings.ToLower(strings.TrimSpace(account.Email))
+	local, _, _ := strings.Cut(email, "@")
+	if email != "" && (strings.Contains(lower, email) || len(local) >= 3 && strings.Contains(lower, local)) {
+		add(RuleContainsEmail, "must not contain your email address")
+	}
+	for _, name := range []string{account.FirstName, account.LastName} {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) >= 3 && strings.Contains(lower, name) {
+			add(RuleContainsName, "must not contain your name")
+			break
+		}
+	}
+
+	if p.Blocklist[lower] {
+		add(RuleBlocklisted, "is too common; choose a different password")
+	}
+	if p.Breaches != nil {
+		breached, err := p.Breaches.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			add(RuleBreached, "has appeared in a data breach; choose a different password")
+		}
+	}
+
+	if score := Strength(password, account.Email, account.FirstName, account.LastName); score < p.MinScore {
+		add(RuleStrength, "is too easy to guess (strength %d of 4, at least %d required)", score, p.MinScore)
+	}
+	return violations, nil
+}
+
+var blocklistCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	entries map[string]bool
+}
+
+// loadBlocklist reads path, reusing the parsed list until the file changes.
+func loadBlocklist(path string) (map[string]bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocklistCache.Lock()
+	defer blocklistCache.Unlock()
+	if blocklistCache.path == path && blocklistCache.modTime.Equal(info.ModTime()) {
+		return blocklistCache.entries, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	blocklistCache.path, blocklistCache.modTime, blocklistCache.entries = path, info.ModTime(), entries
+	return entries, nil
+}
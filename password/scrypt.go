@@ -0,0 +1,68 @@
+package password
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ScryptHasher hashes with scrypt. LogN is log2 of the CPU/memory cost N.
+type ScryptHasher struct {
+	LogN       int
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+func scryptFromEnv() ScryptHasher {
+	return ScryptHasher{
+		LogN:       costFromEnv("SCRYPT_LOG_N", 15),
+		R:          costFromEnv("SCRYPT_R", 8),
+		P:          costFromEnv("SCRYPT_P", 1),
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+func (h ScryptHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(h.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, h.KeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.LogN, h.R, h.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h ScryptHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parsePHC(encoded)
+	if err != nil || p.id != Scrypt {
+		return false, ErrUnknownFormat
+	}
+	ln, r, par := p.params["ln"], p.params["r"], p.params["p"]
+	if ln <= 0 || ln > 30 || r <= 0 || par <= 0 {
+		return false, ErrUnknownFormat
+	}
+	key, err := scrypt.Key([]byte(password), p.salt, 1<<ln, r, par, len(p.hash))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, p.hash) == 1, nil
+}
+
+func (h ScryptHasher) NeedsRehash(encoded string) bool {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return true
+	}
+	return p.params["ln"] < h.LogN ||
+		p.params["r"] < h.R ||
+		p.params["p"] < h.P ||
+		len(p.hash) < h.KeyLength ||
+		len(p.salt) < h.SaltLength
+}
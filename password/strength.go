@@ -0,0 +1,239 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength estimates how many guesses an attacker needs for password, in the
+// spirit of zxcvbn: the password is split into the cheapest sequence of
+// patterns (common passwords, the user's own details, repeats, sequences,
+// keyboard runs, years, and brute-forced characters) and the guesses of each
+// part are multiplied. The result uses zxcvbn's 0-4 scale, from "too
+// guessable" (under 10^3 guesses) to "very unguessable" (10^10 or more).
+func Strength(password string, userInputs ...string) int {
+	log := estimateLog10Guesses(password, userInputs)
+	switch {
+	case log < 3:
+		return 0
+	case log < 6:
+		return 1
+	case log < 8:
+		return 2
+	case log < 10:
+		return 3
+	}
+	return 4
+}
+
+// longestCommon is the length in runes of the longest common password.
+var longestCommon = func() int {
+	n := 0
+	for _, w := range commonPasswords {
+		n = max(n, len([]rune(w)))
+	}
+	return n
+}()
+
+var commonRank = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, w := range commonPasswords {
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = i + 1
+		}
+	}
+	return ranks
+}()
+
+// maxPatternLength bounds the substrings tried as patterns, so the estimate
+// stays linear in the password's length. Longer runs are priced as several
+// patterns.
+const maxPatternLength = 100
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+var leet = strings.NewReplacer("@", "a", "4", "a", "8", "b", "(", "c", "3", "e", "6", "g", "1", "i", "!", "i", "|", "l", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t", "2", "z")
+
+func estimateLog10Guesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	inputs := make(map[string]bool)
+	longestWord := max(longestCommon, len(keyboardRows[0]))
+	for _, in := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(in), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(part) >= 3 {
+				inputs[part] = true
+				longestWord = max(longestWord, len([]rune(part)))
+			}
+		}
+	}
+
+	// best[i] is the cheapest log10(guesses) for the first i runes
+	best := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + math.Log10(bruteForceCardinality(runes[i-1]))
+		for start := max(0, i-maxPatternLength); start <= i-3; start++ {
+			if g, ok := patternLog10Guesses(runes[start:i], inputs, longestWord); ok && best[start]+g < best[i] {
+				best[i] = best[start] + g
+			}
+		}
+	}
+	return best[n]
+}
+
+func bruteForceCardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLower(r), unicode.IsUpper(r):
+		return 26
+	}
+	return 33
+}
+
+// patternLog10Guesses returns the guesses for s when it matches a known pattern.
+// Words and keyboard runs are only looked for in substrings of at most
+// longestWord runes; nothing longer could match one.
+func patternLog10Guesses(s []rune, userInputs map[string]bool, longestWord int) (float64, bool) {
+	best, ok := math.Inf(1), false
+	consider := func(g float64) {
+		if g < best {
+			best, ok = g, true
+		}
+	}
+
+	if isRepeat(s) {
+		consider(math.Log10(bruteForceCardinality(s[0]) * float64(len(s))))
+	}
+	if delta, seq := sequenceDelta(s); seq {
+		start := 26.0
+		if unicode.IsDigit(s[0]) {
+			start = 10
+		}
+		if s[0] == 'a' || s[0] == 'A' || s[0] == '1' || s[0] == '0' || s[0] == 'z' || s[0] == '9' {
+			start = 4
+		}
+		g := math.Log10(start * float64(len(s)))
+		if delta < 0 {
+			g += math.Log10(2)
+		}
+		consider(g)
+	}
+	if len(s) > longestWord {
+		return best, ok
+	}
+
+	raw := string(s)
+	lower := strings.ToLower(raw)
+
+	variations := caseVariations(raw)
+	for _, candidate := range []struct {
+		word  string
+		extra float64
+	}{
+		{lower, 0},
+		{leet.Replace(lower), math.Log10(2)},
+		{reverse(lower), math.Log10(2)},
+	} {
+		if candidate.extra > 0 && candidate.word == lower {
+			continue
+		}
+		if userInputs[candidate.word] {
+			consider(variations + candidate.extra)
+		}
+		if rank, found := commonRank[candidate.word]; found {
+			consider(math.Log10(float64(rank)) + variations + candidate.extra)
+		}
+	}
+
+	if len(s) >= 4 && onKeyboardRow(lower) {
+		consider(math.Log10(40 * float64(len(s))))
+	}
+	if len(s) == 4 && lower >= "1900" && lower <= "2049" && isDigits(lower) {
+		consider(math.Log10(150))
+	}
+	return best, ok
+}
+
+// caseVariations is log10 of the capitalisations an attacker tries for s.
+func caseVariations(s string) float64 {
+	upper, lower := 0, 0
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0, upper == 1 && unicode.IsUpper([]rune(s)[0]):
+		return math.Log10(2)
+	}
+	return math.Log10(float64(binomial(upper+lower, upper)))
+}
+
+func binomial(n, k int) int {
+	r := 1
+	for i := 1; i <= k; i++ {
+		r = r * (n - k + i) / i
+	}
+	return r
+}
+
+func isRepeat(s []rune) bool {
+	for _, r := range s[1:] {
+		if r != s[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func sequenceDelta(s []rune) (int, bool) {
+	delta := int(s[1] - s[0])
+	if delta != 1 && delta != -1 {
+		return 0, false
+	}
+	for i := 2; i < len(s); i++ {
+		if int(s[i]-s[i-1]) != delta {
+			return 0, false
+		}
+	}
+	return delta, true
+}
+
+func onKeyboardRow(s string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(row, reverse(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
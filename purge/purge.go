@@ -0,0 +1,121 @@
+// Package purge erases accounts their owners deleted, once the grace period
+// in User.PurgeAfter has run out.
+package purge
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"gorm.io/gorm"
+)
+
+// userTables hold rows that belong to a user through a user_id column.
+var userTables = []interface{}{
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.ActionToken{},
+	&models.RecoveryCode{},
+	&models.WebAuthnCredential{},
+	&models.WebAuthnSession{},
+	&models.PasswordResetRequest{},
+	&models.PasswordHistory{},
+	&models.LoginCode{},
+	&models.Session{},
+	&models.EmailChange{},
+}
+
+// Run purges due accounts every ACCOUNT_PURGE_INTERVAL_MINUTES (default 60)
+// until ctx is cancelled.
+func Run(ctx context.Context, db *gorm.DB) {
+	interval := time.Duration(config.GetenvInt("ACCOUNT_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := Due(ctx, db, time.Now()); err != nil {
+			log.Println("purge:", err)
+		} else if n > 0 {
+			log.Printf("purge: erased %d deleted accounts", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Due erases every deleted account whose PurgeAfter is before now, together
+// with its related rows, and returns how many it erased.
+func Due(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	db = db.WithContext(ctx)
+	var ids []uint
+	err := db.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND purge_after IS NOT NULL AND purge_after < ?", now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		if err := User(db, id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// User erases the account id and everything that belongs to it.
+func User(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().First(&user, id).Error; err != nil {
+			return err
+		}
+		// every address the account used, for rows keyed by address alone
+		emails := []string{strings.ToLower(user.Email)}
+		var changes []models.EmailChange
+		if err := tx.Where("user_id = ?", id).Find(&changes).Error; err != nil {
+			return err
+		}
+		for _, change := range changes {
+			emails = append(emails, strings.ToLower(change.OldEmail), strings.ToLower(change.NewEmail))
+		}
+
+		for _, table := range userTables {
+			if err := tx.Where("user_id = ?", id).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		// the outbox still holds the addresses, and an unsent message perhaps a code or link
+		if err := tx.Where("user_id = ? OR LOWER(to_address) IN ?", id, emails).Delete(&models.OutboxMessage{}).Error; err != nil {
+			return err
+		}
+		if err := deleteRateLimitBuckets(tx, id, emails); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+}
+
+// deleteRateLimitBuckets removes the shared rate limit counters of the account:
+// keys end in "user:<id>" or "email:<address>", after the rule name (see
+// middleware.KeyByUser and middleware.KeyByEmail).
+func deleteRateLimitBuckets(tx *gorm.DB, id uint, emails []string) error {
+	query := tx.Where("bucket_key LIKE ? ESCAPE '\\'", "%:user:"+strconv.FormatUint(uint64(id), 10))
+	for _, email := range emails {
+		query = query.Or("bucket_key LIKE ? ESCAPE '\\'", "%:email:"+likeEscaper.Replace(email))
+	}
+	return query.Delete(&models.RateLimitBucket{}).Error
+}
+
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
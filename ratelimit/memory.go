@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps state in process memory. It is only suitable for a single
+// replica.
+type MemoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	lastCleanup time.Time
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// cleanupInterval is how often expired entries are swept from a store.
+const cleanupInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Update(_ context.Context, key string, now time.Time, ttl time.Duration, fn func(*State)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastCleanup) > cleanupInterval {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastCleanup = now
+	}
+
+	entry, ok := m.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = memoryEntry{}
+	}
+	fn(&entry.state)
+	entry.expires = now.Add(ttl)
+	m.entries[key] = entry
+	return nil
+}
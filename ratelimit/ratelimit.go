@@ -0,0 +1,166 @@
+// Package ratelimit implements token-bucket and sliding-window rate limits on
+// top of a pluggable Store, so a single node can keep its counters in memory
+// while several replicas share them through the database.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Algorithm selects how a Rule counts requests.
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills
+	// continuously at Limit per Window.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit requests in any Window, estimated from the
+	// counts of the current and previous fixed windows.
+	SlidingWindow
+)
+
+// Rule describes one limit. Name namespaces the keys, so the same client can be
+// tracked independently by different rules.
+type Rule struct {
+	Name      string
+	Limit     int
+	Window    time.Duration
+	Algorithm Algorithm
+}
+
+// Result is the outcome of one request against a rule.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the limit is fully available again
+	RetryAfter time.Duration // until the next request would be allowed; zero when Allowed
+}
+
+// State is the per-key data an algorithm keeps in a Store.
+type State struct {
+	Value float64   // tokens left (bucket) or requests in the current window
+	Prev  float64   // requests in the previous window (sliding window only)
+	Stamp time.Time // last refill (bucket) or start of the current window
+}
+
+// Store persists State per key.
+type Store interface {
+	// Update loads the state for key (the zero State if there is none), lets fn
+	// modify it and saves the result, atomically with respect to other Updates
+	// of the same key. now is the Limiter's time; the entry may be discarded
+	// once ttl has passed after it.
+	Update(ctx context.Context, key string, now time.Time, ttl time.Duration, fn func(*State)) error
+}
+
+// Clock tells a Limiter the time, so tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the real wall clock.
+var SystemClock Clock = systemClock{}
+
+// Limiter applies a Rule using a Store.
+type Limiter struct {
+	Rule  Rule
+	Store Store
+	Clock Clock
+}
+
+// New returns a Limiter for rule backed by store, using the system clock.
+func New(store Store, rule Rule) *Limiter {
+	return &Limiter{Rule: rule, Store: store, Clock: SystemClock}
+}
+
+// Allow counts one request for key and reports whether it may proceed.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := l.Clock.Now()
+	var res Result
+	err := l.Store.Update(ctx, l.Rule.Name+":"+key, now, 2*l.Rule.Window, func(s *State) {
+		switch l.Rule.Algorithm {
+		case SlidingWindow:
+			res = l.slidingWindow(s, now)
+		default:
+			res = l.tokenBucket(s, now)
+		}
+	})
+	return res, err
+}
+
+func (l *Limiter) tokenBucket(s *State, now time.Time) Result {
+	limit := float64(l.Rule.Limit)
+	rate := limit / l.Rule.Window.Seconds() // tokens per second
+
+	if s.Stamp.IsZero() {
+		s.Value = limit
+	} else if elapsed := now.Sub(s.Stamp).Seconds(); elapsed > 0 {
+		s.Value = math.Min(limit, s.Value+elapsed*rate)
+	}
+	s.Stamp = now
+
+	res := Result{Limit: l.Rule.Limit}
+	if s.Value >= 1 {
+		s.Value--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - s.Value) / rate)
+	}
+	res.Remaining = int(math.Floor(s.Value))
+	res.Reset = seconds((limit - s.Value) / rate)
+	return res
+}
+
+func (l *Limiter) slidingWindow(s *State, now time.Time) Result {
+	window := l.Rule.Window
+	start := now.Truncate(window)
+	if !s.Stamp.Equal(start) {
+		if s.Stamp.Equal(start.Add(-window)) {
+			s.Prev = s.Value
+		} else {
+			s.Prev = 0
+		}
+		s.Value = 0
+		s.Stamp = start
+	}
+
+	limit := float64(l.Rule.Limit)
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/window.Seconds()
+	estimate := s.Prev*weight + s.Value
+
+	res := Result{Limit: l.Rule.Limit, Reset: start.Add(window).Sub(now)}
+	if estimate+1 <= limit {
+		s.Value++
+		res.Allowed = true
+		res.Remaining = int(math.Floor(limit - estimate - 1))
+		return res
+	}
+
+	// Wait for the previous window's share to decay enough, or, if the current
+	// window alone is full, for it to become the previous window and decay.
+	if s.Value+1 <= limit && s.Prev > 0 {
+		wait := window.Seconds()*(1-(limit-s.Value-1)/s.Prev) - elapsed.Seconds()
+		res.RetryAfter = seconds(wait)
+	} else {
+		wait := res.Reset.Seconds()
+		if s.Value > 0 {
+			wait += window.Seconds() * math.Max(0, 1-(limit-1)/s.Value)
+		}
+		res.RetryAfter = seconds(wait)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s < 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLStore keeps state in the rate_limit_buckets table so every replica using
+// the same database shares the counters. Updates lock the row for the duration
+// of the transaction.
+type SQLStore struct {
+	db *gorm.DB
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Update(ctx context.Context, key string, now time.Time, ttl time.Duration, fn func(*State)) error {
+	s.cleanup(ctx, now)
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// make sure the row exists so concurrent callers serialize on its lock
+		placeholder := models.RateLimitBucket{Key: key, ExpiresAt: now.Add(ttl)}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&placeholder).Error; err != nil {
+			return err
+		}
+
+		var bucket models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).First(&bucket).Error; err != nil {
+			return err
+		}
+
+		state := State{Value: bucket.Value, Prev: bucket.Prev, Stamp: bucket.Stamp}
+		if now.After(bucket.ExpiresAt) {
+			state = State{}
+		}
+		fn(&state)
+
+		return tx.Model(&models.RateLimitBucket{}).Where("bucket_key = ?", key).Updates(map[string]interface{}{
+			"value":      state.Value,
+			"prev":       state.Prev,
+			"stamp":      state.Stamp,
+			"expires_at": now.Add(ttl),
+		}).Error
+	})
+}
+
+// cleanup deletes expired rows, at most once per cleanupInterval per store.
+func (s *SQLStore) cleanup(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.lastCleanup) > cleanupInterval
+	if due {
+		s.lastCleanup = now
+	}
+	s.mu.Unlock()
+	if due {
+		s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.RateLimitBucket{})
+	}
+}
@@ -0,0 +1,212 @@
+// Package rbac stores roles and permissions and answers permission checks for
+// the role names carried in access tokens.
+package rbac
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"gorm.io/gorm"
+)
+
+// Built-in roles.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Built-in permissions.
+const (
+	PermProfileRead  = "profile:read"
+	PermProfileWrite = "profile:write"
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermRolesManage  = "roles:manage"
+	PermMailManage   = "mail:manage"
+)
+
+// DefaultRole is granted to every new account.
+const DefaultRole = RoleUser
+
+var seedPermissions = []models.Permission{
+	{Name: PermProfileRead, Description: "View own profile"},
+	{Name: PermProfileWrite, Description: "Update own profile"},
+	{Name: PermUsersRead, Description: "View any user"},
+	{Name: PermUsersWrite, Description: "Create, update and disable users"},
+	{Name: PermRolesManage, Description: "Assign and remove roles"},
+	{Name: PermMailManage, Description: "View and requeue undelivered email"},
+}
+
+var seedRoles = map[string]struct {
+	description string
+	permissions []string
+}{
+	RoleAdmin: {"Full administrative access", []string{PermProfileRead, PermProfileWrite, PermUsersRead, PermUsersWrite, PermRolesManage, PermMailManage}},
+	RoleUser:  {"Regular account", []string{PermProfileRead, PermProfileWrite}},
+}
+
+var (
+	ErrUnknownRole    = errors.New("unknown role")
+	ErrLastAdmin      = errors.New("cannot remove the last admin")
+	ErrRoleNotGranted = errors.New("user does not have this role")
+)
+
+// Seed creates the built-in roles and permissions if they are missing and gives
+// the default role to accounts that have none. It is safe to run on every start.
+func Seed(db *gorm.DB) error {
+	for _, perm := range seedPermissions {
+		p := perm
+		if err := db.Where(models.Permission{Name: p.Name}).Attrs(models.Permission{Description: p.Description}).FirstOrCreate(&p).Error; err != nil {
+			return err
+		}
+	}
+
+	for name, def := range seedRoles {
+		role := models.Role{Name: name}
+		if err := db.Where(models.Role{Name: name}).Attrs(models.Role{Description: def.description}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		var perms []models.Permission
+		if err := db.Where("name IN ?", def.permissions).Find(&perms).Error; err != nil {
+			return err
+		}
+		if err := db.Model(&role).Association("Permissions").Append(perms); err != nil {
+			return err
+		}
+	}
+
+	var defaultRole models.Role
+	if err := db.Where("name = ?", DefaultRole).First(&defaultRole).Error; err != nil {
+		return err
+	}
+	err := db.Exec(`INSERT INTO user_roles (user_id, role_id)
+		SELECT id, ? FROM users WHERE id NOT IN (SELECT user_id FROM user_roles)`, defaultRole.ID).Error
+	if err != nil {
+		return err
+	}
+
+	Invalidate()
+	return nil
+}
+
+// BootstrapAdmin grants the admin role to the account with email, if it exists.
+// It lets a fresh deployment get its first administrator (ADMIN_EMAIL).
+func BootstrapAdmin(db *gorm.DB, email string) error {
+	if email == "" {
+		return nil
+	}
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return Assign(user.ID, RoleAdmin)
+}
+
+// UserRoles returns the names of the roles granted to userID.
+func UserRoles(userID uint) ([]string, error) {
+	var names []string
+	err := database.DB.Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// Assign grants role to userID. Granting a role the user already has is a no-op.
+func Assign(userID uint, role string) error {
+	var r models.Role
+	if err := database.DB.Where("name = ?", role).First(&r).Error; err != nil {
+		return ErrUnknownRole
+	}
+	return database.DB.Model(&models.User{Model: gorm.Model{ID: userID}}).Association("Roles").Append(&r)
+}
+
+// Remove takes role away from userID. The last administrator cannot lose the
+// admin role, so the system is never left without one.
+func Remove(userID uint, role string) error {
+	var r models.Role
+	if err := database.DB.Where("name = ?", role).First(&r).Error; err != nil {
+		return ErrUnknownRole
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if role == RoleAdmin {
+			var admins int64
+			if err := tx.Table("user_roles").Where("role_id = ?", r.ID).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return ErrLastAdmin
+			}
+		}
+		res := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, r.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRoleNotGranted
+		}
+		return nil
+	})
+}
+
+// cacheTTL bounds how stale the role-to-permission mapping may be on replicas
+// that did not make a change themselves.
+const cacheTTL = time.Minute
+
+var cache struct {
+	sync.Mutex
+	perms   map[string]map[string]bool
+	expires time.Time
+}
+
+// Invalidate drops the cached role-to-permission mapping.
+func Invalidate() {
+	cache.Lock()
+	cache.perms = nil
+	cache.Unlock()
+}
+
+func rolePermissions() (map[string]map[string]bool, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.perms != nil && time.Now().Before(cache.expires) {
+		return cache.perms, nil
+	}
+
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	perms := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		perms[role.Name] = make(map[string]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			perms[role.Name][p.Name] = true
+		}
+	}
+	cache.perms = perms
+	cache.expires = time.Now().Add(cacheTTL)
+	return perms, nil
+}
+
+// HasPermission reports whether any of roles grants permission.
+func HasPermission(roles []string, permission string) (bool, error) {
+	perms, err := rolePermissions()
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if perms[role][permission] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,31 +1,138 @@
 package routes
 
 import (
+	"os"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
 	"github.com/gbadegesintestimony/jwt-authentication/controllers"
+	"github.com/gbadegesintestimony/jwt-authentication/database"
 	"github.com/gbadegesintestimony/jwt-authentication/middleware"
+	"github.com/gbadegesintestimony/jwt-authentication/ratelimit"
+	"github.com/gbadegesintestimony/jwt-authentication/rbac"
 	"github.com/gin-gonic/gin"
 )
 
+// rateLimit builds a rate limit middleware for rule, or a pass-through one when
+// RATE_LIMIT_ENABLED is false.
+func rateLimit(store ratelimit.Store, clock ratelimit.Clock, rule ratelimit.Rule, key middleware.KeyFunc) gin.HandlerFunc {
+	if !config.GetenvBool("RATE_LIMIT_ENABLED", true) {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return middleware.RateLimit(&ratelimit.Limiter{Rule: rule, Store: store, Clock: clock}, key)
+}
+
+// Setup registers every route on r.
 func Setup(r *gin.Engine) {
+	Register(r, ratelimit.SystemClock)
+}
+
+// Register registers every route on r, with rate limits that read the time
+// from clock. Tests pass a fake clock to step through the limit windows.
+func Register(r *gin.Engine, clock ratelimit.Clock) {
+	// Counters live in memory unless several replicas need to share them
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "sql" {
+		store = ratelimit.NewSQLStore(database.DB)
+	}
+	authByIP := rateLimit(store, clock, ratelimit.Rule{
+		Name:      "auth-ip",
+		Limit:     config.GetenvInt("RATE_LIMIT_AUTH_PER_MINUTE", 30),
+		Window:    time.Minute,
+		Algorithm: ratelimit.SlidingWindow,
+	}, middleware.KeyByIP)
+	byEmail := rateLimit(store, clock, ratelimit.Rule{
+		Name:      "auth-email",
+		Limit:     config.GetenvInt("RATE_LIMIT_EMAIL_PER_HOUR", 20),
+		Window:    time.Hour,
+		Algorithm: ratelimit.TokenBucket,
+	}, middleware.KeyByEmail)
+	byUser := rateLimit(store, clock, ratelimit.Rule{
+		Name:      "user",
+		Limit:     config.GetenvInt("RATE_LIMIT_USER_PER_MINUTE", 120),
+		Window:    time.Minute,
+		Algorithm: ratelimit.TokenBucket,
+	}, middleware.KeyByUser)
+
+	// Public keys for downstream services that verify our tokens
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+
 	// Public routes
 	api := r.Group("/api")
 	{
 		auth := api.Group("/auth")
+		auth.Use(authByIP)
 		{
 			auth.POST("/register", controllers.Register)
-			auth.POST("/login", controllers.Login)
-			auth.POST("/forgot-password", controllers.ForgotPassword)
-			auth.POST("/verify-otp", controllers.VerifyOTP)
-			auth.POST("/reset-password", controllers.ResetPassword)
+			auth.POST("/login", byEmail, controllers.Login)
+			auth.POST("/refresh", controllers.Refresh)
+			auth.POST("/mfa/verify", controllers.VerifyMFA)
+			auth.POST("/mfa/webauthn/options", controllers.WebAuthnMFAOptions)
+			auth.POST("/webauthn/login/begin", controllers.BeginWebAuthnLogin)
+			auth.POST("/webauthn/login/finish", controllers.FinishWebAuthnLogin)
+			auth.POST("/logout", middleware.AuthMiddleware(), controllers.Logout)
+			auth.POST("/logout-all", middleware.AuthMiddleware(), controllers.LogoutAll)
+			auth.POST("/verify-email", controllers.VerifyEmail)
+			auth.POST("/resend-verification", byEmail, controllers.ResendVerification)
+			auth.POST("/unlock", controllers.UnlockAccount)
+			auth.POST("/email/confirm", controllers.ConfirmEmailChange)
+			auth.POST("/email/revert", controllers.RevertEmailChange)
+			auth.POST("/account/restore", controllers.RestoreAccount)
+			auth.POST("/magic-link", byEmail, controllers.RequestMagicLink)
+			auth.POST("/magic-link/consume", controllers.ConsumeMagicLink)
+			auth.POST("/otp/request", byEmail, controllers.RequestLoginCode)
+			auth.POST("/otp/login", byEmail, controllers.LoginWithCode)
+			auth.POST("/forgot-password", byEmail, controllers.ForgotPassword)
+			auth.POST("/verify-otp", byEmail, controllers.VerifyOTP)
+			auth.POST("/reset-password", byEmail, controllers.ResetPassword)
 		}
 
 		// Protected routes
 		protected := api.Group("/")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.AuthMiddleware(), byUser)
 		{
 			protected.POST("/change-password", controllers.ChangePassword)
 			protected.GET("/me", controllers.GetProfile)
 			protected.PUT("/me", controllers.UpdateProfile)
+			protected.DELETE("/me", controllers.DeleteAccount)
+			protected.POST("/me/email", controllers.RequestEmailChange)
+			protected.POST("/me/mfa/totp/enroll", controllers.EnrollTOTP)
+			protected.POST("/me/mfa/totp/confirm", controllers.ConfirmTOTP)
+			protected.POST("/me/mfa/totp/disable", controllers.DisableTOTP)
+			protected.POST("/me/webauthn/register/begin", controllers.BeginWebAuthnRegistration)
+			protected.POST("/me/webauthn/register/finish", controllers.FinishWebAuthnRegistration)
+			protected.GET("/me/webauthn/credentials", controllers.ListWebAuthnCredentials)
+			protected.DELETE("/me/webauthn/credentials/:id", controllers.DeleteWebAuthnCredential)
+			protected.GET("/me/sessions", controllers.ListSessions)
+			protected.DELETE("/me/sessions/:id", controllers.DeleteSession)
+		}
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), byUser, middleware.RequireRole(rbac.RoleAdmin))
+		{
+			manage := middleware.RequirePermission(rbac.PermRolesManage)
+			read := middleware.RequirePermission(rbac.PermUsersRead)
+			write := middleware.RequirePermission(rbac.PermUsersWrite)
+
+			admin.GET("/roles", manage, controllers.ListRoles)
+			admin.GET("/users/:id/roles", manage, controllers.GetUserRoles)
+			admin.POST("/users/:id/roles", manage, controllers.AssignRole)
+			admin.DELETE("/users/:id/roles/:role", manage, controllers.RemoveRole)
+			admin.GET("/users", read, controllers.ListUsers)
+			admin.GET("/users/:id", read, controllers.GetUser)
+			admin.POST("/users", write, controllers.CreateUser)
+			admin.DELETE("/users/:id", write, controllers.DeleteUser)
+			admin.POST("/users/:id/restore", write, controllers.RestoreUser)
+			admin.POST("/users/:id/disable", write, controllers.DisableUser)
+			admin.POST("/users/:id/enable", write, controllers.EnableUser)
+			admin.POST("/users/:id/force-password-reset", write, controllers.ForcePasswordReset)
+			admin.POST("/users/:id/logout", write, controllers.ForceLogout)
+			admin.PUT("/users/:id/email-verified", write, controllers.SetEmailVerified)
+
+			mailManage := middleware.RequirePermission(rbac.PermMailManage)
+			admin.GET("/outbox", mailManage, controllers.ListOutboxMessages)
+			admin.POST("/outbox/:id/requeue", mailManage, controllers.RequeueOutboxMessage)
 		}
 	}
 }
@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/config"
+)
+
+// clockSkew is added to token lifetimes when deciding whether a superseded key
+// may still have unexpired tokens in circulation.
+const clockSkew = time.Minute
+
+// keyRingReloadInterval bounds how often the manifest file is checked for changes.
+const keyRingReloadInterval = 10 * time.Second
+
+// KeyRingEntry describes one key in the key ring manifest.
+//
+// A key signs from SignFrom until a newer key's SignFrom is reached. It keeps
+// verifying after that until every token it signed has expired, and never
+// verifies past RetireAt.
+type KeyRingEntry struct {
+	ID       string     `json:"kid"`
+	Alg      string     `json:"alg"`
+	File     string     `json:"file"` // PEM private key, or the raw secret for HS256; relative to the manifest
+	SignFrom time.Time  `json:"sign_from"`
+	RetireAt *time.Time `json:"retire_at,omitempty"`
+}
+
+// KeyRingManifest is the on-disk description of the key ring (JWT_KEYRING_FILE).
+type KeyRingManifest struct {
+	Keys []KeyRingEntry `json:"keys"`
+}
+
+// KeyStatus is the role of a key ring entry at a point in time.
+type KeyStatus string
+
+const (
+	KeyPending   KeyStatus = "pending"   // published for verification, not signing yet
+	KeySigning   KeyStatus = "signing"   // the current signing key
+	KeyVerifying KeyStatus = "verifying" // superseded, but its tokens may still be live
+	KeyRetired   KeyStatus = "retired"   // no longer accepted
+)
+
+// Status reports the role of entry at now, given the rest of the manifest and
+// the longest lifetime of a token signed by the ring.
+func (m *KeyRingManifest) Status(entry KeyRingEntry, now time.Time, tokenLifetime time.Duration) KeyStatus {
+	if entry.RetireAt != nil && !now.Before(*entry.RetireAt) {
+		return KeyRetired
+	}
+	if now.Before(entry.SignFrom) {
+		return KeyPending
+	}
+	if signer := m.signer(now); signer != nil && signer.ID == entry.ID {
+		return KeySigning
+	}
+	if supersededAt, ok := m.SupersededAt(entry); ok && !now.Before(supersededAt.Add(tokenLifetime+clockSkew)) {
+		return KeyRetired
+	}
+	return KeyVerifying
+}
+
+// SupersededAt returns when a newer key took over signing from entry.
+func (m *KeyRingManifest) SupersededAt(entry KeyRingEntry) (time.Time, bool) {
+	var at time.Time
+	found := false
+	for _, other := range m.Keys {
+		if other.ID == entry.ID || !other.SignFrom.After(entry.SignFrom) {
+			continue
+		}
+		if other.RetireAt != nil && !other.RetireAt.After(other.SignFrom) {
+			continue // retired before it ever signed
+		}
+		if !found || other.SignFrom.Before(at) {
+			at, found = other.SignFrom, true
+		}
+	}
+	return at, found
+}
+
+// signer returns the entry that signs at now: the most recently promoted key that
+// is not retired.
+func (m *KeyRingManifest) signer(now time.Time) *KeyRingEntry {
+	var best *KeyRingEntry
+	for i := range m.Keys {
+		entry := &m.Keys[i]
+		if now.Before(entry.SignFrom) || (entry.RetireAt != nil && !now.Before(*entry.RetireAt)) {
+			continue
+		}
+		if best == nil || entry.SignFrom.After(best.SignFrom) {
+			best = entry
+		}
+	}
+	return best
+}
+
+// Find returns the index of the entry with kid, or -1.
+func (m *KeyRingManifest) Find(kid string) int {
+	for i, entry := range m.Keys {
+		if entry.ID == kid {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadKeyRingManifest reads the manifest at path. A missing file yields an empty manifest.
+func LoadKeyRingManifest(path string) (*KeyRingManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &KeyRingManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m KeyRingManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to path atomically.
+func (m *KeyRingManifest) Save(path string) error {
+	sort.Slice(m.Keys, func(i, j int) bool { return m.Keys[i].SignFrom.Before(m.Keys[j].SignFrom) })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GenerateKeyFile creates a new private key (or HMAC secret) for alg in dir and
+// returns a manifest entry for it, with SignFrom left for the caller to set.
+func GenerateKeyFile(dir, alg string) (KeyRingEntry, error) {
+	if alg == "HS256" {
+		secret, err := RandomToken(32)
+		if err != nil {
+			return KeyRingEntry{}, err
+		}
+		kid, err := RandomToken(8)
+		if err != nil {
+			return KeyRingEntry{}, err
+		}
+		kid = "hs256-" + kid
+		file := kid + ".secret"
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(secret+"\n"), 0o600); err != nil {
+			return KeyRingEntry{}, err
+		}
+		return KeyRingEntry{ID: kid, Alg: alg, File: file}, nil
+	}
+
+	var private interface{}
+	var err error
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 3072)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return KeyRingEntry{}, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if err != nil {
+		return KeyRingEntry{}, err
+	}
+
+	key, err := newAsymmetricKey(private)
+	if err != nil {
+		return KeyRingEntry{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return KeyRingEntry{}, err
+	}
+	file := key.ID + ".pem"
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, file), data, 0o600); err != nil {
+		return KeyRingEntry{}, err
+	}
+	return KeyRingEntry{ID: key.ID, Alg: key.Method.Alg(), File: file}, nil
+}
+
+// ringKey pairs a loaded key with its manifest entry.
+type ringKey struct {
+	entry KeyRingEntry
+	key   *signingKey
+}
+
+// keyRing holds every key the service may sign or verify with. Which key signs
+// and which keys verify is decided from the manifest dates at call time, so
+// promotions and retirements take effect without a restart.
+type keyRing struct {
+	mu       sync.RWMutex
+	manifest *KeyRingManifest
+	keys     map[string]ringKey
+
+	path    string // manifest file; empty for a fixed single-key ring
+	modTime time.Time
+	checked time.Time
+}
+
+var ring = &keyRing{manifest: &KeyRingManifest{}, keys: map[string]ringKey{}}
+
+// newStaticKeyRing wraps a single key that signs and verifies forever.
+func newStaticKeyRing(key *signingKey) *keyRing {
+	entry := KeyRingEntry{ID: key.ID, Alg: key.Method.Alg()}
+	return &keyRing{
+		manifest: &KeyRingManifest{Keys: []KeyRingEntry{entry}},
+		keys:     map[string]ringKey{key.ID: {entry: entry, key: key}},
+	}
+}
+
+// loadKeyRing reads the manifest at path and every key it references.
+func loadKeyRing(path string) (*keyRing, error) {
+	r := &keyRing{path: path}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *keyRing) load() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	manifest, err := LoadKeyRingManifest(r.path)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]ringKey, len(manifest.Keys))
+	dir := filepath.Dir(r.path)
+	for _, entry := range manifest.Keys {
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		var key *signingKey
+		if entry.Alg == "HS256" {
+			secret, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			key = newHMACKey([]byte(strings.TrimSpace(string(secret))))
+			key.ID = entry.ID
+		} else {
+			if key, err = loadPrivateKeyFile(file, entry.ID); err != nil {
+				return err
+			}
+		}
+		if key.ID == "" {
+			return fmt.Errorf("%s: key ring entry has no kid", file)
+		}
+		keys[key.ID] = ringKey{entry: entry, key: key}
+	}
+
+	r.mu.Lock()
+	r.manifest = manifest
+	r.keys = keys
+	r.modTime = info.ModTime()
+	r.checked = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// reloadIfChanged re-reads the manifest when the file has been modified. Errors
+// keep the previously loaded ring in place.
+func (r *keyRing) reloadIfChanged(now time.Time) {
+	if r.path == "" {
+		return
+	}
+	r.mu.RLock()
+	due := now.Sub(r.checked) >= keyRingReloadInterval
+	modTime := r.modTime
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	r.checked = now
+	r.mu.Unlock()
+
+	if info, err := os.Stat(r.path); err == nil && !info.ModTime().Equal(modTime) {
+		if err := r.load(); err != nil {
+			fmt.Fprintln(os.Stderr, "key ring reload failed:", err)
+		}
+	}
+}
+
+// signer returns the key that signs new tokens at now.
+func (r *keyRing) signer(now time.Time) (*signingKey, error) {
+	r.reloadIfChanged(now)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry := r.manifest.signer(now)
+	if entry == nil {
+		return nil, errors.New("no signing key is active")
+	}
+	return r.keys[entry.ID].key, nil
+}
+
+// verifier returns the key with kid if it may verify tokens at now.
+func (r *keyRing) verifier(kid string, now time.Time) (*signingKey, bool) {
+	r.reloadIfChanged(now)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rk, ok := r.keys[kid]
+	if !ok || r.manifest.Status(rk.entry, now, accessTokenTTL) == KeyRetired {
+		return nil, false
+	}
+	return rk.key, true
+}
+
+// published returns every key that may verify tokens at now, including keys
+// that will start signing later so verifiers can cache them in advance.
+func (r *keyRing) published(now time.Time) []*signingKey {
+	r.reloadIfChanged(now)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []*signingKey
+	for _, entry := range r.manifest.Keys {
+		if r.manifest.Status(entry, now, accessTokenTTL) == KeyRetired {
+			continue
+		}
+		if rk, ok := r.keys[entry.ID]; ok {
+			keys = append(keys, rk.key)
+		}
+	}
+	return keys
+}
+
+// ConfiguredAccessTokenTTL reads the access token lifetime from JWT_ACCESS_TOKEN_MINUTES.
+func ConfiguredAccessTokenTTL() time.Duration {
+	return time.Duration(config.GetenvInt("JWT_ACCESS_TOKEN_MINUTES", 15)) * time.Minute
+}
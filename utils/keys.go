@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a key the service can sign or verify tokens with.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{} // passed to Method.Sign
+	public  interface{} // passed to Method.Verify; nil for symmetric keys
+}
+
+// verifyKey returns the key material used to check signatures.
+func (k *signingKey) verifyKey() interface{} {
+	if k.public != nil {
+		return k.public
+	}
+	return k.private
+}
+
+// JWK is a public key in RFC 7517 JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// newHMACKey wraps a shared secret. Symmetric keys are never published.
+func newHMACKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(append([]byte("kid:"), secret...))
+	return &signingKey{
+		ID:      "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:6]),
+		Method:  jwt.SigningMethodHS256,
+		private: secret,
+	}
+}
+
+// loadPrivateKeyFile reads a PEM encoded RSA, ECDSA or Ed25519 private key and
+// picks the matching JWS algorithm. When kid is empty the RFC 7638 thumbprint of
+// the public key is used.
+func loadPrivateKeyFile(path, kid string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, err := newAsymmetricKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if kid != "" {
+		key.ID = kid
+	}
+	return key, nil
+}
+
+func newAsymmetricKey(private interface{}) (*signingKey, error) {
+	key := &signingKey{private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+		key.public = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.public = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	jwk, err := key.jwk()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = jwkThumbprint(jwk)
+	return key, nil
+}
+
+// jwk returns the public half of k as a JWK.
+func (k *signingKey) jwk() (JWK, error) {
+	jwk := JWK{Use: "sig", Alg: k.Method.Alg(), Kid: k.ID}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return JWK{}, errors.New("key has no public component")
+	}
+	return jwk, nil
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of jwk.
+func jwkThumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// JWKS returns the public verification keys. Symmetric keys are omitted, so the
+// set is empty while the service signs with JWT_SECRET.
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ring.published(time.Now()) {
+		if key.public == nil {
+			continue
+		}
+		if jwk, err := key.jwk(); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// revocationCacheTTL bounds how long a lookup is trusted before the database is
+// consulted again. Revocations made by this process are visible immediately;
+// those made by other replicas become visible within this window.
+const revocationCacheTTL = 30 * time.Second
+
+type cachedRevocation struct {
+	revoked bool
+	expires time.Time
+}
+
+type cachedVersion struct {
+	version uint
+	expires time.Time
+}
+
+// revocationStore is the database-backed revocation list with an in-memory cache.
+type revocationStore struct {
+	mu       sync.Mutex
+	jtis     map[string]cachedRevocation
+	versions map[uint]cachedVersion
+	sessions map[string]cachedRevocation
+	touched  map[string]time.Time // when each session's last_seen_at was last written
+}
+
+var revocations = newRevocationStore()
+
+func newRevocationStore() *revocationStore {
+	return &revocationStore{
+		jtis:     make(map[string]cachedRevocation),
+		versions: make(map[uint]cachedVersion),
+		sessions: make(map[string]cachedRevocation),
+		touched:  make(map[string]time.Time),
+	}
+}
+
+// RevokeToken adds the access token described by claims to the revocation list.
+func RevokeToken(claims *Claims) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti")
+	}
+	expiresAt := time.Now().Add(accessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	record := models.RevokedToken{JTI: claims.ID, UserID: claims.UserID, ExpiresAt: expiresAt}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+	// opportunistically drop entries that can no longer match a valid token
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+
+	revocations.mu.Lock()
+	revocations.jtis[claims.ID] = cachedRevocation{revoked: true, expires: expiresAt}
+	revocations.mu.Unlock()
+	return nil
+}
+
+// RevokeAllTokens invalidates every access token issued to userID so far by
+// bumping the user's token version.
+func RevokeAllTokens(userID uint) error {
+	err := database.DB.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	delete(revocations.versions, userID)
+	revocations.mu.Unlock()
+	return nil
+}
+
+// IsTokenRevoked reports whether the token described by claims was revoked,
+// either individually, with its session, or by a later RevokeAllTokens for
+// its user.
+func IsTokenRevoked(claims *Claims) (bool, error) {
+	version, err := currentTokenVersion(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if claims.TokenVersion < version {
+		return true, nil
+	}
+	if claims.SessionID != "" {
+		if revoked, err := isSessionRevoked(claims.SessionID); err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if claims.ID == "" {
+		return false, nil
+	}
+	return isJTIRevoked(claims.ID)
+}
+
+func isJTIRevoked(jti string) (bool, error) {
+	now := time.Now()
+
+	revocations.mu.Lock()
+	entry, ok := revocations.jtis[jti]
+	revocations.mu.Unlock()
+	if ok && (entry.revoked || now.Before(entry.expires)) {
+		return entry.revoked, nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	revoked := count > 0
+
+	revocations.mu.Lock()
+	if revoked {
+		// Revoked entries are kept until the token itself would have expired.
+		revocations.jtis[jti] = cachedRevocation{revoked: true, expires: now.Add(accessTokenTTL)}
+	} else {
+		revocations.jtis[jti] = cachedRevocation{expires: now.Add(revocationCacheTTL)}
+	}
+	revocations.pruneLocked(now)
+	revocations.mu.Unlock()
+	return revoked, nil
+}
+
+func currentTokenVersion(userID uint) (uint, error) {
+	now := time.Now()
+
+	revocations.mu.Lock()
+	entry, ok := revocations.versions[userID]
+	revocations.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.version, nil
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	revocations.mu.Lock()
+	revocations.versions[userID] = cachedVersion{version: user.TokenVersion, expires: now.Add(revocationCacheTTL)}
+	revocations.mu.Unlock()
+	return user.TokenVersion, nil
+}
+
+// pruneLocked evicts stale cache entries; the caller must hold mu.
+func (s *revocationStore) pruneLocked(now time.Time) {
+	if len(s.jtis) >= 10000 {
+		for jti, entry := range s.jtis {
+			if now.After(entry.expires) {
+				delete(s.jtis, jti)
+			}
+		}
+	}
+	if len(s.sessions) >= 10000 {
+		for id, entry := range s.sessions {
+			if now.After(entry.expires) {
+				delete(s.sessions, id)
+				delete(s.touched, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/gbadegesintestimony/jwt-authentication/database"
+	"github.com/gbadegesintestimony/jwt-authentication/models"
+)
+
+// sessionTouchInterval bounds how often a session's last_seen_at is written.
+const sessionTouchInterval = time.Minute
+
+// RevokeSession ends the session with id: its access tokens stop being
+// accepted. The caller revokes the session's refresh tokens.
+func RevokeSession(id string) error {
+	err := database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.sessions[id] = cachedRevocation{revoked: true, expires: time.Now().Add(accessTokenTTL)}
+	revocations.mu.Unlock()
+	return nil
+}
+
+// RevokeUserSessions ends every session of userID.
+func RevokeUserSessions(userID uint) error {
+	var ids []string
+	if err := database.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := RevokeSession(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TouchSession records that the session with id was just used. Writes are
+// throttled to one per sessionTouchInterval per session.
+func TouchSession(id string) {
+	now := time.Now()
+	revocations.mu.Lock()
+	last, ok := revocations.touched[id]
+	if ok && now.Sub(last) < sessionTouchInterval {
+		revocations.mu.Unlock()
+		return
+	}
+	revocations.touched[id] = now
+	revocations.mu.Unlock()
+
+	database.DB.Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", now)
+}
+
+// isSessionRevoked reports whether the session with id was ended. A session
+// that does not exist counts as revoked.
+func isSessionRevoked(id string) (bool, error) {
+	now := time.Now()
+
+	revocations.mu.Lock()
+	entry, ok := revocations.sessions[id]
+	revocations.mu.Unlock()
+	if ok && (entry.revoked || now.Before(entry.expires)) {
+		return entry.revoked, nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	revoked := count == 0
+
+	revocations.mu.Lock()
+	if revoked {
+		revocations.sessions[id] = cachedRevocation{revoked: true, expires: now.Add(accessTokenTTL)}
+	} else {
+		revocations.sessions[id] = cachedRevocation{expires: now.Add(revocationCacheTTL)}
+	}
+	revocations.pruneLocked(now)
+	revocations.mu.Unlock()
+	return revoked, nil
+}
@@ -2,57 +2,167 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
 	"os"
-	"strconv"
 	"time"
 
+	"github.com/gbadegesintestimony/jwt-authentication/config"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey []byte
-var jwtExpirationHours int
+var accessTokenTTL = 15 * time.Minute
+var refreshTokenTTL = 30 * 24 * time.Hour
 
 func Init() {
-	s := os.Getenv("JWT_SECRET")
-	if s == "" {
-		s = "Change_This_SecretKey"
+	// Prefer a key ring manifest, then a single asymmetric key so other services
+	// can verify tokens through the JWKS endpoint, then the shared HMAC secret.
+	if path := os.Getenv("JWT_KEYRING_FILE"); path != "" {
+		r, err := loadKeyRing(path)
+		if err != nil {
+			log.Fatal("Failed to load JWT key ring: ", err)
+		}
+		ring = r
+	} else if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		key, err := loadPrivateKeyFile(path, os.Getenv("JWT_KEY_ID"))
+		if err != nil {
+			log.Fatal("Failed to load JWT signing key: ", err)
+		}
+		ring = newStaticKeyRing(key)
+	} else {
+		s := os.Getenv("JWT_SECRET")
+		if s == "" {
+			s = "Change_This_SecretKey"
+		}
+		ring = newStaticKeyRing(newHMACKey([]byte(s)))
 	}
-	jwtKey = []byte(s)
 
-	hours := 24
-	if s2 := os.Getenv("JWT_EXPIRATION_HOURS"); s2 != "" {
-		if h, err := strconv.Atoi(s2); err == nil {
-			hours = h
-		}
+	if err := initTokenHashKey(); err != nil {
+		log.Fatal("Failed to load token hash key: ", err)
 	}
-	jwtExpirationHours = hours
+
+	accessTokenTTL = ConfiguredAccessTokenTTL()
+	refreshTokenTTL = time.Duration(config.GetenvInt("JWT_REFRESH_TOKEN_DAYS", 30)) * 24 * time.Hour
+
+	revocations = newRevocationStore()
 }
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID       uint     `json:"user_id"`
+	TokenVersion uint     `json:"ver"`
+	Roles        []string `json:"roles,omitempty"`
+	SessionID    string   `json:"sid,omitempty"`
+	Purpose      string   `json:"purpose,omitempty"` // empty for access tokens
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint) (string, error) {
+// Purposes of challenge tokens. They are only accepted by the endpoint that
+// completes the matching step and never as access tokens.
+const (
+	PurposeMFA = "mfa"
+)
+
+var errWrongTokenPurpose = errors.New("token cannot be used here")
+
+// TokenSubject describes who an access token is issued to.
+type TokenSubject struct {
+	UserID       uint
+	TokenVersion uint // must match the user's current version for the token to be accepted
+	Roles        []string
+	SessionID    string // the login the token belongs to; revoking it revokes the token
+}
+
+// AccessToken is a signed access token together with its identifying metadata.
+type AccessToken struct {
+	Token     string
+	ID        string // the jti claim
+	ExpiresAt time.Time
+}
+
+// GenerateToken signs a short-lived access token for subject.
+func GenerateToken(subject TokenSubject) (AccessToken, error) {
+	return signToken(subject, "", accessTokenTTL)
+}
+
+// GenerateChallengeToken signs a token that only proves a login step (such as
+// the password check before MFA) was completed for subject.
+func GenerateChallengeToken(subject TokenSubject, purpose string, ttl time.Duration) (AccessToken, error) {
+	return signToken(subject, purpose, ttl)
+}
+
+func signToken(subject TokenSubject, purpose string, ttl time.Duration) (AccessToken, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := &Claims{
-		UserID: userID,
+		UserID:       subject.UserID,
+		TokenVersion: subject.TokenVersion,
+		Roles:        subject.Roles,
+		SessionID:    subject.SessionID,
+		Purpose:      purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(jwtExpirationHours) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	key, err := ring.signer(now)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	return AccessToken{Token: signed, ID: jti, ExpiresAt: expiresAt}, nil
 }
 
+// ParseToken verifies an access token. Challenge tokens are rejected.
 func ParseToken(tokenStr string) (*Claims, error) {
+	claims, err := parseClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errWrongTokenPurpose
+	}
+	return claims, nil
+}
+
+// ParseChallengeToken verifies a challenge token issued for purpose.
+func ParseChallengeToken(tokenStr, purpose string) (*Claims, error) {
+	claims, err := parseClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errWrongTokenPurpose
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.verifier(kid, time.Now())
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// the algorithm is bound to the key, never taken from the token alone
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, jwt.ErrSignatureInvalid
 		}
-		return jwtKey, nil
+		return key.verifyKey(), nil
 	})
 	if err != nil {
 		return nil, err
@@ -63,6 +173,36 @@ func ParseToken(tokenStr string) (*Claims, error) {
 	return nil, jwt.ErrSignatureInvalid
 }
 
+// RefreshTokenTTL reports how long a newly issued refresh token stays valid.
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
+}
+
+// GenerateRefreshToken returns a new opaque refresh token together with the hash
+// that should be persisted. Only the hash is ever stored.
+func GenerateRefreshToken() (token string, hash string, err error) {
+	token, err = RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the lookup hash for an opaque refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes encoded as unpadded base64url.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func GenerateOTP() (string, error) {
 	max := big.NewInt(999999)
 	n, err := rand.Int(rand.Reader, max)